@@ -0,0 +1,223 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the reason label of metrics_scrape_denied_total.
+const (
+	DeniedNetwork     = "network"
+	DeniedCertificate = "certificate"
+	DeniedCredentials = "credentials"
+)
+
+// MetricsAuthConfig restricts access to the metrics endpoint. Every
+// configured check must pass; the zero value allows all requests.
+type MetricsAuthConfig struct {
+	// BearerToken is accepted in an "Authorization: Bearer" header.
+	BearerToken string
+
+	// Username and Password are accepted as HTTP basic auth. When a bearer
+	// token is set as well, either credential is accepted.
+	Username string
+	Password string
+
+	// AllowedNetworks lists the client IPs or CIDRs allowed to scrape, e.g.
+	// "10.0.0.0/8" or "::1". The client IP is read with fiber.Ctx.IP, so it
+	// honours the app's proxy header settings.
+	AllowedNetworks []string
+
+	// ClientCertSubjects lists the accepted subjects of verified TLS client
+	// certificates, either the common name or the full RFC 2253 subject,
+	// e.g. "prometheus" or "CN=prometheus,O=Monitoring".
+	ClientCertSubjects []string
+}
+
+// metricsAuth checks the requests to the metrics endpoint.
+type metricsAuth struct {
+	bearer   []byte
+	username []byte
+	password []byte
+	networks []netip.Prefix
+	subjects map[string]bool
+	denied   *prometheus.CounterVec
+}
+
+// SetMetricsAuth protects the metrics endpoints of RegisterAt and
+// ServeMetrics, including pprof, with a bearer token, basic auth, an IP
+// allowlist and TLS client certificate subjects. Denied requests are
+// answered with 403, or 401 for missing credentials, and counted in
+// metrics_scrape_denied_total by reason.
+func (ps *FiberPrometheus) SetMetricsAuth(cfg MetricsAuthConfig) error {
+	if (cfg.Username == "") != (cfg.Password == "") {
+		return errors.New("fiberprometheus: basic auth needs a username and a password")
+	}
+
+	auth := &metricsAuth{}
+	if cfg.BearerToken != "" {
+		auth.bearer = []byte(cfg.BearerToken)
+	}
+	if cfg.Username != "" {
+		auth.username = []byte(cfg.Username)
+		auth.password = []byte(cfg.Password)
+	}
+	for _, network := range cfg.AllowedNetworks {
+		prefix, err := parseNetwork(network)
+		if err != nil {
+			return err
+		}
+		auth.networks = append(auth.networks, prefix)
+	}
+	if len(cfg.ClientCertSubjects) > 0 {
+		auth.subjects = make(map[string]bool, len(cfg.ClientCertSubjects))
+		for _, subject := range cfg.ClientCertSubjects {
+			auth.subjects[subject] = true
+		}
+	}
+
+	if ps.metricsAuth != nil {
+		auth.denied = ps.metricsAuth.denied
+	} else {
+		counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "metrics_scrape_denied_total"),
+			Help:        "Count all denied requests to the metrics endpoint by reason.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("reason"))
+		if err := ps.registerVecs(&counter); err != nil {
+			return err
+		}
+		auth.denied = counter
+	}
+	ps.metricsAuth = auth
+	return nil
+}
+
+// parseNetwork parses an IP or a CIDR into a prefix.
+func parseNetwork(network string) (netip.Prefix, error) {
+	if strings.Contains(network, "/") {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("fiberprometheus: invalid network %q: %w", network, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(network)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("fiberprometheus: invalid network %q: %w", network, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// authorizeMetrics reports whether the request may read the metrics, and
+// otherwise answers it.
+func (ps *FiberPrometheus) authorizeMetrics(c fiber.Ctx) (bool, error) {
+	if ps.metricsAuth == nil {
+		return true, nil
+	}
+	return ps.metricsAuth.authorize(c)
+}
+
+// requireMetricsAuth is a handler applying SetMetricsAuth to other debug
+// endpoints, such as pprof.
+func (ps *FiberPrometheus) requireMetricsAuth(c fiber.Ctx) error {
+	if ok, err := ps.authorizeMetrics(c); !ok {
+		return err
+	}
+	return c.Next()
+}
+
+// authorize reports whether the request may read the metrics, and otherwise
+// answers it.
+func (a *metricsAuth) authorize(c fiber.Ctx) (bool, error) {
+	if a.networks != nil && !a.allowNetwork(c) {
+		a.denied.WithLabelValues(DeniedNetwork).Inc()
+		return false, c.SendStatus(fiber.StatusForbidden)
+	}
+	if a.subjects != nil && !a.allowCertificate(c) {
+		a.denied.WithLabelValues(DeniedCertificate).Inc()
+		return false, c.SendStatus(fiber.StatusForbidden)
+	}
+	if (a.bearer != nil || a.username != nil) && !a.allowCredentials(c) {
+		a.denied.WithLabelValues(DeniedCredentials).Inc()
+		if a.bearer != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		} else {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="metrics"`)
+		}
+		return false, c.SendStatus(fiber.StatusUnauthorized)
+	}
+	return true, nil
+}
+
+func (a *metricsAuth) allowNetwork(c fiber.Ctx) bool {
+	addr, err := netip.ParseAddr(c.IP())
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.networks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *metricsAuth) allowCertificate(c fiber.Ctx) bool {
+	state := c.RequestCtx().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return false
+	}
+	subject := state.VerifiedChains[0][0].Subject
+	return a.subjects[subject.CommonName] || a.subjects[subject.String()]
+}
+
+func (a *metricsAuth) allowCredentials(c fiber.Ctx) bool {
+	scheme, credentials, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	switch {
+	case a.bearer != nil && strings.EqualFold(scheme, "Bearer"):
+		return subtle.ConstantTimeCompare([]byte(credentials), a.bearer) == 1
+	case a.username != nil && strings.EqualFold(scheme, "Basic"):
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return false
+		}
+		username, password, _ := bytes.Cut(decoded, []byte(":"))
+		// Compare both so the timing does not reveal a valid username.
+		user := subtle.ConstantTimeCompare(username, a.username)
+		pass := subtle.ConstantTimeCompare(password, a.password)
+		return user&pass == 1
+	}
+	return false
+}
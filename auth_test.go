@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsAuthCredentials(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	err := fp.SetMetricsAuth(MetricsAuthConfig{
+		BearerToken: "secret",
+		Username:    "prometheus",
+		Password:    "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	fp.RegisterAt(app, "/metrics")
+	app.Use(fp.Middleware)
+
+	tests := []struct {
+		name   string
+		setup  func(*http.Request)
+		status int
+	}{
+		{"none", func(*http.Request) {}, 401},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, 200},
+		{"wrong bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secreT") }, 401},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("prometheus", "password") }, 200},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") }, 401},
+		{"wrong username", func(r *http.Request) { r.SetBasicAuth("grafana", "password") }, 401},
+		{"malformed basic", func(r *http.Request) { r.Header.Set("Authorization", "Basic !!!") }, 401},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		tt.setup(req)
+		resp, _ := app.Test(req)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: got status %d; want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if tt.status == 401 && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: got WWW-Authenticate %q; want Bearer", tt.name, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	if got := testutil.ToFloat64(fp.metricsAuth.denied.WithLabelValues(DeniedCredentials)); got != 5 {
+		t.Errorf("got %v denied scrapes; want 5", got)
+	}
+}
+
+func TestMetricsAuthBasic(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	if err := fp.SetMetricsAuth(MetricsAuthConfig{Username: "prometheus", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	fp.RegisterAt(app, "/metrics")
+	app.Use(fp.Middleware)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if resp.StatusCode != 401 || resp.Header.Get("WWW-Authenticate") != `Basic realm="metrics"` {
+		t.Errorf("got %d %q; want a basic auth challenge", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	// A bearer token is not accepted without BearerToken.
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer password")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != 401 {
+		t.Errorf("got status %d; want 401", resp.StatusCode)
+	}
+}
+
+func TestMetricsAuthNetworks(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	if err := fp.SetMetricsAuth(MetricsAuthConfig{AllowedNetworks: []string{"10.0.0.0/8", "::1"}}); err != nil {
+		t.Fatal(err)
+	}
+	server, err := fp.ServeMetrics("127.0.0.1:0", MetricsServerConfig{HealthPath: "/livez", Pprof: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fp.Close() })
+	base := "http://" + server.Addr().String()
+
+	for path, want := range map[string]int{"/metrics": 403, "/debug/pprof/": 403, "/livez": 200} {
+		if status, _ := get(t, base+path); status != want {
+			t.Errorf("got status %d from %s; want %d", status, path, want)
+		}
+	}
+
+	if err := fp.SetMetricsAuth(MetricsAuthConfig{AllowedNetworks: []string{"127.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get(t, base+"/metrics"); status != 200 {
+		t.Errorf("got status %d; want 200", status)
+	}
+	if got := testutil.ToFloat64(fp.metricsAuth.denied.WithLabelValues(DeniedNetwork)); got != 2 {
+		t.Errorf("got %v denied scrapes; want 2", got)
+	}
+}
+
+func TestMetricsAuthInvalidConfig(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+
+	for _, cfg := range []MetricsAuthConfig{
+		{Username: "prometheus"},
+		{Password: "password"},
+		{AllowedNetworks: []string{"10.0.0.0/33"}},
+		{AllowedNetworks: []string{"localhost"}},
+	} {
+		if err := fp.SetMetricsAuth(cfg); err == nil {
+			t.Errorf("got no error for %+v", cfg)
+		}
+	}
+}
+
+// testCertificate issues a certificate for subject, signed by parent, or
+// self-signed when parent is nil.
+func testCertificate(t *testing.T, subject pkix.Name, parent *tls.Certificate, isCA bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestMetricsAuthClientCertificate(t *testing.T) {
+	t.Parallel()
+	ca := testCertificate(t, pkix.Name{CommonName: "test-ca"}, nil, true)
+	serverCert := testCertificate(t, pkix.Name{CommonName: "metrics"}, &ca, false)
+	prometheusCert := testCertificate(t, pkix.Name{CommonName: "prometheus", Organization: []string{"Monitoring"}}, &ca, false)
+	otherCert := testCertificate(t, pkix.Name{CommonName: "grafana"}, &ca, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	if err := fp.SetMetricsAuth(MetricsAuthConfig{ClientCertSubjects: []string{"CN=prometheus,O=Monitoring"}}); err != nil {
+		t.Fatal(err)
+	}
+	server, err := fp.ServeMetrics("127.0.0.1:0", MetricsServerConfig{
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			ClientCAs:    pool,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fp.Close() })
+
+	scrape := func(certs ...tls.Certificate) int {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: certs,
+		}}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("https://" + server.Addr().String() + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := scrape(prometheusCert); status != 200 {
+		t.Errorf("got status %d with the prometheus certificate; want 200", status)
+	}
+	if status := scrape(otherCert); status != 403 {
+		t.Errorf("got status %d with another certificate; want 403", status)
+	}
+	if status := scrape(); status != 403 {
+		t.Errorf("got status %d without a certificate; want 403", status)
+	}
+	if got := testutil.ToFloat64(fp.metricsAuth.denied.WithLabelValues(DeniedCertificate)); got != 2 {
+		t.Errorf("got %v denied scrapes; want 2", got)
+	}
+}
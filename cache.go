@@ -0,0 +1,176 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the cache_result label once normalized.
+const (
+	CacheHit         = "hit"
+	CacheMiss        = "miss"
+	CacheUnreachable = "unreachable"
+	CacheBypass      = "bypass"
+	CacheOther       = "other"
+)
+
+// defaultCacheResults is the default allowlist of the cache_result label.
+var defaultCacheResults = []string{CacheHit, CacheMiss, CacheUnreachable, CacheBypass}
+
+// NormalizeCacheResult maps the cache header values of common caches to one
+// of CacheHit, CacheMiss, CacheUnreachable, CacheBypass or CacheOther.
+//
+// Values are case folded and only the first entry of a comma separated list
+// is considered, so "HIT from edge-42", "TCP_MEM_HIT" and "HIT, MISS" are all
+// hits. Stale and revalidated responses count as hits, expired ones as misses
+// and uncacheable ones as bypass.
+func NormalizeCacheResult(value string) string {
+	value, _, _ = strings.Cut(value, ",")
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch {
+	case value == "":
+		return ""
+	case strings.Contains(value, "unreachable"):
+		return CacheUnreachable
+	case strings.Contains(value, "bypass"), strings.Contains(value, "dynamic"), strings.Contains(value, "pass"):
+		return CacheBypass
+	case strings.Contains(value, "miss"), strings.Contains(value, "expired"):
+		return CacheMiss
+	case strings.Contains(value, "hit"), strings.Contains(value, "stale"),
+		strings.Contains(value, "revalidated"), strings.Contains(value, "updating"):
+		return CacheHit
+	default:
+		return CacheOther
+	}
+}
+
+// CacheResultConfig configures the cache_result label of cache_results.
+type CacheResultConfig struct {
+	// Normalize maps the raw cache header value to a label value. Defaults
+	// to NormalizeCacheResult.
+	Normalize func(string) string
+
+	// Allow lists the accepted label values, after normalization, other
+	// values are recorded as CacheOther. Defaults to hit, miss, unreachable
+	// and bypass.
+	Allow []string
+
+	// HitRatio registers the cache_hit_ratio gauge, the share of hits among
+	// hits and misses per route template since start.
+	HitRatio bool
+}
+
+// SetCacheResultConfig replaces the normalization and allowlist of the
+// cache_result label, and optionally enables the cache_hit_ratio gauge.
+//
+// By default cache_result values are normalized with NormalizeCacheResult, so
+// a custom cache can not create unbounded series. Raw header values can still
+// be counted with AddHeaderCounter.
+func (ps *FiberPrometheus) SetCacheResultConfig(cfg CacheResultConfig) error {
+	if cfg.Normalize == nil {
+		cfg.Normalize = NormalizeCacheResult
+	}
+	if len(cfg.Allow) == 0 {
+		cfg.Allow = defaultCacheResults
+	}
+
+	if cfg.HitRatio && ps.cacheCounter.hitRatio == nil {
+		ratio := &cacheHitRatio{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(ps.namespace, ps.subsystem, "cache_hit_ratio"),
+				"Share of cache hits among hits and misses since start, by route.",
+				[]string{"route"},
+				ps.instanceLabels(),
+			),
+			route: ps.lookupRoute,
+		}
+		if err := ps.register(ratio); err != nil {
+			return err
+		}
+		ps.cacheCounter.hitRatio = ratio
+	}
+
+	ps.cacheCounter.normalize = cfg.Normalize
+	ps.cacheCounter.setAllow(cfg.Allow)
+	return nil
+}
+
+// cacheHitRatio is a collector of the cache hit ratio per route.
+type cacheHitRatio struct {
+	desc *prometheus.Desc
+	// route resolves the route template. Cache hits are answered before the
+	// router dispatches, so the matched route is not always available.
+	route  func(fiber.Ctx) string
+	routes sync.Map // route -> *cacheLookups
+}
+
+type cacheLookups struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func (r *cacheHitRatio) observe(ctx fiber.Ctx, result string) {
+	if result != CacheHit && result != CacheMiss {
+		return
+	}
+	route := r.route(ctx)
+	v, ok := r.routes.Load(route)
+	if !ok {
+		v, _ = r.routes.LoadOrStore(route, &cacheLookups{})
+	}
+	lookups := v.(*cacheLookups)
+	if result == CacheHit {
+		lookups.hits.Add(1)
+	} else {
+		lookups.misses.Add(1)
+	}
+}
+
+// Reset forgets the lookups of all routes.
+func (r *cacheHitRatio) Reset() {
+	r.routes.Clear()
+}
+
+// Describe implements prometheus.Collector.
+func (r *cacheHitRatio) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.desc
+}
+
+// Collect implements prometheus.Collector.
+func (r *cacheHitRatio) Collect(ch chan<- prometheus.Metric) {
+	r.routes.Range(func(k, v any) bool {
+		lookups := v.(*cacheLookups)
+		hits, misses := lookups.hits.Load(), lookups.misses.Load()
+		if hits+misses > 0 {
+			ratio := float64(hits) / float64(hits+misses)
+			ch <- prometheus.MustNewConstMetric(r.desc, prometheus.GaugeValue, ratio, k.(string))
+		}
+		return true
+	})
+}
@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/cache"
+)
+
+func TestNormalizeCacheResult(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":                 "",
+		"hit":              CacheHit,
+		"HIT from edge-42": CacheHit,
+		"TCP_MEM_HIT":      CacheHit,
+		"HIT, MISS":        CacheHit,
+		"STALE":            CacheHit,
+		"REVALIDATED":      CacheHit,
+		"miss":             CacheMiss,
+		"Miss from edge-7": CacheMiss,
+		"EXPIRED":          CacheMiss,
+		"unreachable":      CacheUnreachable,
+		"BYPASS":           CacheBypass,
+		"DYNAMIC":          CacheBypass,
+		"4f1c9a":           CacheOther,
+	}
+	for value, want := range cases {
+		if got := NormalizeCacheResult(value); got != want {
+			t.Errorf("NormalizeCacheResult(%q) = %q; want %q", value, got, want)
+		}
+	}
+}
+
+func TestCacheResultsAreBounded(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		c.Set("X-Cache", c.Query("cache"))
+		return c.SendString("Hello World")
+	})
+
+	for _, value := range []string{"HIT%20from%20edge-42", "random-1", "random-2"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/?cache="+value, nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	want := `http_cache_results{cache_result="hit",method="GET",path="/?cache=HIT%20from%20edge-42",service="test-service",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_cache_results{cache_result="other",method="GET",path="/?cache=random-1",service="test-service",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	notWant := `cache_result="random-1"`
+	if strings.Contains(got, notWant) {
+		t.Errorf("Expected raw cache header values to be normalized, but found: %s", notWant)
+	}
+}
+
+func TestCacheHitRatio(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.SetCacheResultConfig(CacheResultConfig{HitRatio: true}); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Use(cache.New())
+	app.Get("/articles/:id", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	for _, path := range []string{"/articles/1", "/articles/1", "/articles/1", "/articles/2"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", path, nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	want := `http_cache_hit_ratio{route="/articles/:id",service="test-service"} 0.5`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestSetCacheResultConfigAllowlist(t *testing.T) {
+	t.Parallel()
+
+	prometheus := New("test-service")
+	err := prometheus.SetCacheResultConfig(CacheResultConfig{
+		Normalize: strings.ToLower,
+		Allow:     []string{"hit", "edge"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc := prometheus.cacheCounter
+	if hc.normalize("EDGE") != "edge" {
+		t.Error("expected custom normalization")
+	}
+	if _, ok := hc.allow["edge"]; !ok {
+		t.Error("expected custom allowlist")
+	}
+	if _, ok := hc.allow["miss"]; ok {
+		t.Error("expected the default allowlist to be replaced")
+	}
+}
@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// ClientConfig configures InstrumentClient.
+type ClientConfig struct {
+	// TraceConnections replaces the client's dial function to record DNS
+	// lookup and connect durations, as well as failed connection attempts.
+	TraceConnections bool
+}
+
+// clientMetrics holds the outbound request collectors. They are registered
+// once per FiberPrometheus and shared by all instrumented clients.
+type clientMetrics struct {
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	dnsDuration     *prometheus.HistogramVec
+	connectDuration *prometheus.HistogramVec
+}
+
+type clientStartKey struct{}
+
+// InstrumentClient records the requests made with a Fiber client in
+// client_requests_total and client_request_duration_seconds, by host, method
+// and status code. The metrics are registered into the same registry as the
+// instance's own metrics.
+//
+// Attempts that fail without a response, such as refused connections or
+// timeouts, are counted with status code "error". Each failed attempt is
+// counted, including those fasthttp retries. Failures are only seen for
+// clients backed by a fasthttp.Client or fasthttp.HostClient; clients created
+// with a fasthttp.LBClient only record responses.
+//
+// Enable ClientConfig.TraceConnections to also record DNS lookups and
+// connection attempts in client_dns_duration_seconds and
+// client_connect_duration_seconds.
+func (ps *FiberPrometheus) InstrumentClient(c *client.Client, cfg ...ClientConfig) error {
+	var config ClientConfig
+	if len(cfg) > 0 {
+		config = cfg[0]
+	}
+
+	metrics, err := ps.clientCollectors()
+	if err != nil {
+		return err
+	}
+
+	c.AddRequestHook(func(_ *client.Client, req *client.Request) error {
+		req.SetContext(context.WithValue(req.Context(), clientStartKey{}, ps.clock.Now()))
+		return nil
+	})
+	c.AddResponseHook(func(_ *client.Client, resp *client.Response, req *client.Request) error {
+		start, ok := req.Context().Value(clientStartKey{}).(time.Time)
+		if !ok {
+			return nil
+		}
+		host := string(req.RawRequest.URI().Host())
+		method := req.Method()
+		status := strconv.Itoa(resp.StatusCode())
+
+		metrics.requestsTotal.WithLabelValues(host, method, status).Inc()
+		metrics.requestDuration.WithLabelValues(host, method, status).Observe(ps.clock.Since(start).Seconds())
+		return nil
+	})
+
+	switch {
+	case c.FasthttpClient() != nil:
+		fc := c.FasthttpClient()
+		fc.Transport = &failureTransport{ps: ps, metrics: metrics, next: fc.Transport}
+	case c.HostClient() != nil:
+		hc := c.HostClient()
+		hc.Transport = &failureTransport{ps: ps, metrics: metrics, next: hc.Transport}
+	}
+
+	if config.TraceConnections {
+		dialer := &fasthttp.TCPDialer{
+			Resolver: &timingResolver{ps: ps, observe: metrics.dnsDuration},
+		}
+		c.SetDial(func(addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+
+			start := ps.clock.Now()
+			conn, err := dialer.Dial(addr)
+			result := "success"
+			if err != nil {
+				result = "error"
+			}
+			metrics.connectDuration.WithLabelValues(host, result).Observe(ps.clock.Since(start).Seconds())
+			return conn, err
+		})
+	}
+	return nil
+}
+
+// clientCollectors registers the outbound request collectors on first use.
+func (ps *FiberPrometheus) clientCollectors() (*clientMetrics, error) {
+	if ps.clientMetrics != nil {
+		return ps.clientMetrics, nil
+	}
+
+	metrics := &clientMetrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "client_requests_total"),
+			Help:        "Count all outbound http requests by host, method and status code.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("host", "method", "status_code")),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "client_request_duration_seconds"),
+			Help:        "Duration of all outbound HTTP requests by host, method and status code.",
+			ConstLabels: ps.constLabels,
+			Buckets:     defaultBuckets,
+		}, ps.labelNames("host", "method", "status_code")),
+		dnsDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "client_dns_duration_seconds"),
+			Help:        "Duration of DNS lookups of outbound HTTP requests by host.",
+			ConstLabels: ps.constLabels,
+			Buckets:     defaultBuckets,
+		}, ps.labelNames("host")),
+		connectDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "client_connect_duration_seconds"),
+			Help:        "Duration of connection attempts of outbound HTTP requests by host and result.",
+			ConstLabels: ps.constLabels,
+			Buckets:     defaultBuckets,
+		}, ps.labelNames("host", "result")),
+	}
+
+	err := ps.registerVecs(
+		&metrics.requestsTotal,
+		&metrics.requestDuration,
+		&metrics.dnsDuration,
+		&metrics.connectDuration,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.clientMetrics = metrics
+	return metrics, nil
+}
+
+// timingResolver records the duration of the DNS lookups made by
+// fasthttp.TCPDialer. Cached lookups are not observed.
+type timingResolver struct {
+	ps      *FiberPrometheus
+	observe *prometheus.HistogramVec
+}
+
+func (r *timingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	start := r.ps.clock.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	r.observe.WithLabelValues(host).Observe(r.ps.clock.Since(start).Seconds())
+	return addrs, err
+}
+
+// failureTransport counts the attempts that fail without a response. Requests
+// that get a response are recorded by the client's response hook.
+type failureTransport struct {
+	ps      *FiberPrometheus
+	metrics *clientMetrics
+	next    fasthttp.RoundTripper
+}
+
+func (t *failureTransport) RoundTrip(hc *fasthttp.HostClient, req *fasthttp.Request, resp *fasthttp.Response) (bool, error) {
+	next := t.next
+	if next == nil {
+		next = fasthttp.DefaultTransport
+	}
+
+	start := t.ps.clock.Now()
+	retry, err := next.RoundTrip(hc, req, resp)
+	if err != nil {
+		host := string(req.URI().Host())
+		method := string(req.Header.Method())
+		t.metrics.requestsTotal.WithLabelValues(host, method, "error").Inc()
+		t.metrics.requestDuration.WithLabelValues(host, method, "error").Observe(t.ps.clock.Since(start).Seconds())
+	}
+	return retry, err
+}
@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v3/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentClient(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+
+	registry := prometheus.NewRegistry()
+	fp := NewWithRegistry(registry, "test-service", "http", "", nil)
+
+	cc := client.New()
+	if err := fp.InstrumentClient(cc, ClientConfig{TraceConnections: true}); err != nil {
+		t.Fatal(err)
+	}
+	// A second client shares the already registered collectors.
+	if err := fp.InstrumentClient(client.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := cc.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+	if _, err := cc.Post(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens on port 1, the connection attempt fails.
+	if _, err := cc.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("expected request to a closed port to fail")
+	}
+
+	metrics := fp.clientMetrics
+	if got := testutil.ToFloat64(metrics.requestsTotal.WithLabelValues(u.Host, "GET", "200")); got != 2 {
+		t.Errorf("got %v GET 200 requests; want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.requestsTotal.WithLabelValues(u.Host, "GET", "404")); got != 1 {
+		t.Errorf("got %v GET 404 requests; want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.requestsTotal.WithLabelValues(u.Host, "POST", "200")); got != 1 {
+		t.Errorf("got %v POST 200 requests; want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.requestsTotal.WithLabelValues("127.0.0.1:1", "GET", "error")); got != 1 {
+		t.Errorf("got %v failed GET requests; want 1", got)
+	}
+	if got := testutil.CollectAndCount(metrics.requestDuration); got != 4 {
+		t.Errorf("got %d duration series; want 4", got)
+	}
+	if got := testutil.CollectAndCount(metrics.connectDuration); got != 2 {
+		t.Errorf("got %d connect series; want success and error", got)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, family := range families {
+		found = found || family.GetName() == "http_client_requests_total"
+	}
+	if !found {
+		t.Error("http_client_requests_total is not registered in the instance's registry")
+	}
+}
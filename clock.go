@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import "time"
+
+// Clock is the time source used to measure request durations. Since is only
+// ever called with times returned by the same clock's Now. Implementations
+// must be safe for concurrent use and should not allocate, they are called
+// twice per request.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+}
+
+// systemClock reads the wall and monotonic clocks of the time package. It is
+// the default, and being a zero-size value it costs no allocation.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// monotonicClock reads the wall clock once, when created, and only the
+// monotonic clock afterwards.
+type monotonicClock struct {
+	base time.Time
+}
+
+// NewMonotonicClock returns a Clock that reads only the monotonic clock,
+// which is cheaper than time.Now on most platforms. Durations are
+// as exact as with the system clock, but the wall time it reports does not
+// follow later adjustments of the system time, which skews the queue time
+// computed from X-Request-Start after such a step.
+func NewMonotonicClock() Clock {
+	return monotonicClock{base: time.Now()}
+}
+
+func (c monotonicClock) Now() time.Time { return c.base.Add(time.Since(c.base)) }
+
+func (monotonicClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// SetClock replaces the clock measuring durations, e.g. with
+// NewMonotonicClock or fiberprometheustest.FakeClock to replay or test exact
+// durations. It measures:
+//
+//   - request durations, and through them SLOs and slow requests
+//   - queue times from X-Request-Start
+//   - connection lifetimes
+//   - load shedder latencies
+//   - series last updates for SetSeriesTTL
+//   - outbound requests, DNS lookups and connects of InstrumentClient
+//   - upstream requests of InstrumentProxy
+//   - the time of the route statistics page snapshots
+//
+// A nil clock restores the system clock. Set it before serving requests and
+// before calling InstrumentProxy, which keeps the clock of its upstreams.
+func (ps *FiberPrometheus) SetClock(clock Clock) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	ps.clock = clock
+}
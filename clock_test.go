@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/proxy"
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/fiberprometheustest"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestClockBucketPlacement(t *testing.T) {
+	t.Parallel()
+
+	cases := []time.Duration{
+		1500 * time.Nanosecond,
+		5 * time.Millisecond, // on a bucket boundary
+		5*time.Millisecond + time.Nanosecond,
+		250 * time.Millisecond,
+		45 * time.Second, // above the largest bucket
+	}
+	for _, d := range cases {
+		app := fiber.New()
+		clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+		prometheus := fiberprometheus.New("test-service")
+		prometheus.SetClock(clock)
+		app.Use(prometheus.Middleware)
+		app.Get("/", func(c fiber.Ctx) error {
+			clock.Advance(d)
+			return c.SendString("Hello World")
+		})
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+
+		h := writeHistogram(t, prometheus.RequestDuration(), "200", "GET", "/")
+		if got := h.GetSampleSum(); got != d.Seconds() {
+			t.Errorf("%s: got sum %g; want %g", d, got, d.Seconds())
+		}
+		for _, b := range h.GetBucket() {
+			want := uint64(0)
+			if d.Seconds() <= b.GetUpperBound() {
+				want = 1
+			}
+			if b.GetCumulativeCount() != want {
+				t.Errorf("%s: bucket le=%s has %d observations; want %d", d,
+					strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64), b.GetCumulativeCount(), want)
+			}
+		}
+	}
+}
+
+func TestClockProxyUpstreams(t *testing.T) {
+	t.Parallel()
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		clock.Advance(1086086 * time.Microsecond)
+	}))
+	t.Cleanup(upstream.Close)
+
+	registry := prometheus.NewRegistry()
+	fp := fiberprometheus.NewWithRegistry(registry, "test-service", "http", "", nil)
+	fp.SetClock(clock)
+	cfg, err := fp.InstrumentProxy(proxy.Config{Servers: []string{upstream.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Get("/", proxy.Balancer(cfg))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, family := range families {
+		if family.GetName() == "http_upstream_request_duration_seconds" {
+			sum = family.GetMetric()[0].GetHistogram().GetSampleSum()
+		}
+	}
+	if want := (1086086 * time.Microsecond).Seconds(); sum != want {
+		t.Errorf("got upstream duration %gs; want %gs", sum, want)
+	}
+}
+
+func TestSetClockNil(t *testing.T) {
+	t.Parallel()
+
+	prometheus := fiberprometheus.New("test-service")
+	prometheus.SetClock(fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0)))
+	prometheus.SetClock(nil)
+	if _, ok := prometheus.Clock().(fiberprometheus.SystemClock); !ok {
+		t.Errorf("got %T; want the system clock", prometheus.Clock())
+	}
+}
+
+func TestMonotonicClock(t *testing.T) {
+	t.Parallel()
+
+	clock := fiberprometheus.NewMonotonicClock()
+	start := clock.Now()
+	if skew := time.Since(start); skew < 0 || skew > time.Second {
+		t.Errorf("monotonic clock is %s away from the system clock", skew)
+	}
+	time.Sleep(time.Millisecond)
+	if got := clock.Since(start); got < time.Millisecond {
+		t.Errorf("got %s; want at least 1ms", got)
+	}
+}
+
+func TestClockAllocations(t *testing.T) {
+	for name, clock := range map[string]fiberprometheus.Clock{
+		"system":    fiberprometheus.New("test-service").Clock(),
+		"monotonic": fiberprometheus.NewMonotonicClock(),
+	} {
+		allocs := testing.AllocsPerRun(100, func() {
+			start := clock.Now()
+			_ = clock.Since(start)
+		})
+		if allocs != 0 {
+			t.Errorf("%s clock: got %v allocations per request; want 0", name, allocs)
+		}
+	}
+}
+
+func writeHistogram(t *testing.T, vec *prometheus.HistogramVec, labels ...string) *dto.Histogram {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := vec.WithLabelValues(labels...).(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram()
+}
+
+func BenchmarkClock(b *testing.B) {
+	for name, clock := range map[string]fiberprometheus.Clock{
+		"system":    fiberprometheus.SystemClock{},
+		"monotonic": fiberprometheus.NewMonotonicClock(),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				start := clock.Now()
+				_ = clock.Since(start)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command fiberprometheus-dashboard writes a Grafana dashboard for the
+// metrics exported by fiberprometheus.
+//
+//	fiberprometheus-dashboard -namespace my_app -subsystem http -label team=core > dashboard.json
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/internal/cmdutil"
+)
+
+func main() {
+	var metrics cmdutil.Metrics
+	metrics.RegisterFlags(flag.CommandLine)
+	title := flag.String("title", "", "dashboard title")
+	uid := flag.String("uid", "", "dashboard uid")
+	out := flag.String("out", "", "output file, defaults to stdout")
+	flag.Parse()
+
+	fp := metrics.New()
+	cfg := fiberprometheus.DashboardConfig{Title: *title, UID: *uid}
+	if err := cmdutil.Write(*out, func(w io.Writer) error { return fp.WriteDashboard(w, cfg) }); err != nil {
+		log.Fatal(err)
+	}
+}
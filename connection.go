@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConnectionKey is the fiber.Ctx local holding the *Connection of a request.
+// It is a string so websocket implementations copying the locals into the
+// upgraded connection, such as gofiber/contrib/websocket, keep it.
+const ConnectionKey = "fiberprometheus.connection"
+
+// Values of the protocol label of connection metrics.
+const (
+	ProtocolWebSocket = "websocket"
+	ProtocolSSE       = "sse"
+)
+
+// mimeEventStream is the content type of server-sent events.
+const mimeEventStream = "text/event-stream"
+
+// connectionBuckets spans the lifetime of long-lived connections, from one
+// second to one day.
+var connectionBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200, 14400, 43200, 86400}
+
+// connectionMetrics holds the collectors of long-lived connections.
+type connectionMetrics struct {
+	active   *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	messages *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+}
+
+// EnableConnectionMetrics makes Middleware WebSocket and SSE aware.
+//
+// Upgraded WebSocket requests and text/event-stream responses are still
+// counted in requests_total, but no longer observed in request_duration_seconds,
+// where a single connection open for hours would distort the percentiles.
+//
+// Handlers report the lifetime and traffic of these connections through
+// Connection, which feeds connections_active, connection_duration_seconds,
+// connection_messages_total and connection_bytes_total, by route and protocol.
+func (ps *FiberPrometheus) EnableConnectionMetrics() error {
+	if ps.connections != nil {
+		return nil
+	}
+
+	labels := ps.labelNames("route", "protocol")
+	metrics := &connectionMetrics{
+		active: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "connections_active"),
+			Help:        "Long-lived WebSocket and SSE connections currently open, by route and protocol.",
+			ConstLabels: ps.constLabels,
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "connection_duration_seconds"),
+			Help:        "Lifetime of long-lived WebSocket and SSE connections, by route and protocol.",
+			ConstLabels: ps.constLabels,
+			Buckets:     connectionBuckets,
+		}, labels),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "connection_messages_total"),
+			Help:        "Count all messages of long-lived connections by route, protocol and direction.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("route", "protocol", "direction")),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "connection_bytes_total"),
+			Help:        "Count all message bytes of long-lived connections by route, protocol and direction.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("route", "protocol", "direction")),
+	}
+	err := ps.registerVecs(&metrics.active, &metrics.duration, &metrics.messages, &metrics.bytes)
+	if err != nil {
+		return err
+	}
+
+	ps.connections = metrics
+	return nil
+}
+
+// Connection returns the tracker of the long-lived connection served by ctx,
+// creating it on first use. It returns nil, on which all methods are no-ops,
+// unless EnableConnectionMetrics was called.
+//
+// The connection counts as active once the handler returned an upgraded or
+// event-stream response, and until Close is called. Handlers that keep the
+// connection open after returning, from a websocket callback or an SSE stream
+// writer, must defer Close there:
+//
+//	app.Get("/events", func(c fiber.Ctx) error {
+//		conn := prom.Connection(c)
+//		c.Set(fiber.HeaderContentType, "text/event-stream")
+//		return c.SendStreamWriter(func(w *bufio.Writer) {
+//			defer conn.Close()
+//			n, _ := fmt.Fprint(w, "data: hello\n\n")
+//			conn.Sent(n)
+//		})
+//	})
+//
+// For websockets, call Connection from a middleware before the upgrade and
+// read it in the callback with c.Locals(fiberprometheus.ConnectionKey).
+// A connection that is neither hijacked nor streamed is closed by Middleware
+// when the handler returns.
+func (ps *FiberPrometheus) Connection(ctx fiber.Ctx) *Connection {
+	if ps.connections == nil {
+		return nil
+	}
+	if conn, ok := ctx.Locals(ConnectionKey).(*Connection); ok {
+		return conn
+	}
+
+	protocol := ProtocolSSE
+	if ctx.IsWebSocket() {
+		protocol = ProtocolWebSocket
+	}
+	route := ps.lookupRoute(ctx)
+	m := ps.connections
+	conn := &Connection{
+		clock:        ps.clock,
+		start:        ps.clock.Now(),
+		active:       m.active.WithLabelValues(route, protocol),
+		duration:     m.duration.WithLabelValues(route, protocol),
+		sentMessages: m.messages.WithLabelValues(route, protocol, "sent"),
+		sentBytes:    m.bytes.WithLabelValues(route, protocol, "sent"),
+		recvMessages: m.messages.WithLabelValues(route, protocol, "received"),
+		recvBytes:    m.bytes.WithLabelValues(route, protocol, "received"),
+	}
+	ctx.Locals(ConnectionKey, conn)
+	return conn
+}
+
+// Connection tracks one long-lived connection. It is safe for concurrent use.
+type Connection struct {
+	clock        Clock
+	start        time.Time
+	active       prometheus.Gauge
+	duration     prometheus.Observer
+	sentMessages prometheus.Counter
+	sentBytes    prometheus.Counter
+	recvMessages prometheus.Counter
+	recvBytes    prometheus.Counter
+
+	mu     sync.Mutex
+	opened bool
+	closed bool
+}
+
+// Sent counts a message of n bytes sent to the client.
+func (c *Connection) Sent(n int) {
+	if c == nil {
+		return
+	}
+	c.sentMessages.Inc()
+	c.sentBytes.Add(float64(n))
+}
+
+// Received counts a message of n bytes received from the client.
+func (c *Connection) Received(n int) {
+	if c == nil {
+		return
+	}
+	c.recvMessages.Inc()
+	c.recvBytes.Add(float64(n))
+}
+
+// Close records the lifetime of the connection. Only the first call counts.
+func (c *Connection) Close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if c.opened {
+		c.active.Dec()
+	}
+	c.duration.Observe(c.clock.Since(c.start).Seconds())
+}
+
+// open marks the connection as active, unless it was already closed.
+func (c *Connection) open() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.opened || c.closed {
+		return
+	}
+	c.opened = true
+	c.active.Inc()
+}
+
+// discard drops a connection that turned out to be a plain request.
+func (c *Connection) discard() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+// isLongLived reports whether the response upgraded the connection or
+// started an event stream.
+func isLongLived(ctx fiber.Ctx, status int) bool {
+	if status == fiber.StatusSwitchingProtocols {
+		return true
+	}
+	contentType := ctx.GetRespHeader(fiber.HeaderContentType, "")
+	return strings.HasPrefix(contentType, mimeEventStream)
+}
+
+// trackConnection hands the connection of a long-lived response over to the
+// handler, or closes it when the handler is already done with it.
+func (ps *FiberPrometheus) trackConnection(ctx fiber.Ctx, longLived bool) {
+	conn, ok := ctx.Locals(ConnectionKey).(*Connection)
+	if !ok {
+		return
+	}
+	if !longLived {
+		conn.discard()
+		return
+	}
+	conn.open()
+	if !ctx.RequestCtx().Hijacked() && !ctx.Response().IsBodyStream() {
+		conn.Close()
+	}
+}
@@ -0,0 +1,220 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestConnectionMetricsSSE(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.EnableConnectionMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/events/:topic", func(c fiber.Ctx) error {
+		conn := prometheus.Connection(c)
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		return c.SendStreamWriter(func(w *bufio.Writer) {
+			defer conn.Close()
+			for i := 0; i < 3; i++ {
+				n, _ := fmt.Fprintf(w, "data: %d\n\n", i)
+				conn.Sent(n)
+				w.Flush()
+			}
+		})
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/events/news", nil))
+	events, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(events) != "data: 0\n\ndata: 1\n\ndata: 2\n\n" {
+		t.Fatalf("unexpected stream %q", events)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ = app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	for _, want := range []string{
+		`http_requests_total{method="GET",path="/events/news",service="test-service",status_code="200"} 1`,
+		`http_connections_active{protocol="sse",route="/events/:topic",service="test-service"} 0`,
+		`http_connection_duration_seconds_count{protocol="sse",route="/events/:topic",service="test-service"} 1`,
+		`http_connection_messages_total{direction="sent",protocol="sse",route="/events/:topic",service="test-service"} 3`,
+		`http_connection_bytes_total{direction="sent",protocol="sse",route="/events/:topic",service="test-service"} 27`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+
+	notWant := `http_request_duration_seconds_count{method="GET",path="/events/news"`
+	if strings.Contains(got, notWant) {
+		t.Errorf("Expected the event stream to be excluded from the request histogram, but found: %s", notWant)
+	}
+}
+
+func TestConnectionMetricsWebSocket(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.EnableConnectionMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	opened := make(chan struct{})
+	release := make(chan struct{})
+	closed := make(chan struct{})
+	app.Use("/ws", func(c fiber.Ctx) error {
+		prometheus.Connection(c)
+		return c.Next()
+	})
+	app.Get("/ws/:room", func(c fiber.Ctx) error {
+		conn := c.Locals(ConnectionKey).(*Connection)
+		c.Status(fiber.StatusSwitchingProtocols)
+		c.RequestCtx().Hijack(func(net.Conn) {
+			defer close(closed)
+			defer conn.Close()
+			close(opened)
+			conn.Received(5)
+			conn.Sent(5)
+			<-release
+		})
+		return nil
+	})
+
+	req := httptest.NewRequest("GET", "/ws/lobby", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	// The request only returns once the hijacked connection is closed.
+	go app.Test(req, fiber.TestConfig{Timeout: 0})
+
+	select {
+	case <-opened:
+	case <-time.After(time.Second):
+		t.Fatal("connection was not hijacked")
+	}
+	active := `http_connections_active{protocol="websocket",route="/ws/:room",service="test-service"} 1`
+	if got := scrapeMetrics(t, app); !strings.Contains(got, active) {
+		t.Errorf("got %s; want %s", got, active)
+	}
+
+	close(release)
+	<-closed
+	got := scrapeMetrics(t, app)
+	for _, want := range []string{
+		`http_connections_active{protocol="websocket",route="/ws/:room",service="test-service"} 0`,
+		`http_connection_duration_seconds_count{protocol="websocket",route="/ws/:room",service="test-service"} 1`,
+		`http_connection_messages_total{direction="received",protocol="websocket",route="/ws/:room",service="test-service"} 1`,
+		`http_connection_bytes_total{direction="sent",protocol="websocket",route="/ws/:room",service="test-service"} 5`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+	if strings.Contains(got, `http_request_duration_seconds_count{method="GET",path="/ws/lobby"`) {
+		t.Error("Expected the websocket to be excluded from the request histogram")
+	}
+}
+
+func TestConnectionDisabled(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		conn := prometheus.Connection(c)
+		if conn != nil {
+			t.Error("expected no connection tracker")
+		}
+		conn.Sent(1)
+		conn.Close()
+		return c.SendString("Hello World")
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+}
+
+func TestConnectionPlainRequest(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.EnableConnectionMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/events", func(c fiber.Ctx) error {
+		// The client did not ask for a stream, so a plain response is sent.
+		prometheus.Connection(c)
+		return c.SendString("Hello World")
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/events", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	got := scrapeMetrics(t, app)
+	want := `http_connection_duration_seconds_count{protocol="sse",route="/events",service="test-service"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("Expected a plain response not to be tracked as a connection, got %s", got)
+	}
+	want = `http_request_duration_seconds_count{method="GET",path="/events",service="test-service",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func scrapeMetrics(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
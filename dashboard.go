@@ -0,0 +1,220 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DashboardConfig configures WriteDashboard.
+type DashboardConfig struct {
+	// Title of the dashboard. Defaults to "Fiber <namespace>_<subsystem>".
+	Title string
+
+	// UID of the dashboard. Grafana generates one when empty.
+	UID string
+
+	// Window is the range used in rate() queries. Defaults to
+	// "$__rate_interval".
+	Window string
+}
+
+type dashboard struct {
+	UID           string              `json:"uid,omitempty"`
+	Title         string              `json:"title"`
+	Tags          []string            `json:"tags"`
+	Timezone      string              `json:"timezone"`
+	SchemaVersion int                 `json:"schemaVersion"`
+	Refresh       string              `json:"refresh"`
+	Time          map[string]string   `json:"time"`
+	Templating    dashboardTemplating `json:"templating"`
+	Panels        []dashboardPanel    `json:"panels"`
+}
+
+type dashboardTemplating struct {
+	List []dashboardVariable `json:"list"`
+}
+
+type dashboardVariable struct {
+	Name       string               `json:"name"`
+	Label      string               `json:"label,omitempty"`
+	Type       string               `json:"type"`
+	Query      any                  `json:"query"`
+	Datasource *dashboardDatasource `json:"datasource,omitempty"`
+	Refresh    int                  `json:"refresh,omitempty"`
+	IncludeAll bool                 `json:"includeAll,omitempty"`
+	Multi      bool                 `json:"multi,omitempty"`
+	AllValue   string               `json:"allValue,omitempty"`
+}
+
+type dashboardDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type dashboardPanel struct {
+	ID          int                 `json:"id"`
+	Title       string              `json:"title"`
+	Type        string              `json:"type"`
+	Datasource  dashboardDatasource `json:"datasource"`
+	GridPos     map[string]int      `json:"gridPos"`
+	Targets     []dashboardTarget   `json:"targets"`
+	FieldConfig map[string]any      `json:"fieldConfig"`
+	Options     map[string]any      `json:"options,omitempty"`
+}
+
+type dashboardTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Format       string `json:"format,omitempty"`
+}
+
+var dashboardPrometheus = dashboardDatasource{Type: "prometheus", UID: "${datasource}"}
+
+// WriteDashboard writes a Grafana dashboard as JSON with RED panels, a
+// latency heatmap, the cache hit ratio and requests in flight. Queries use
+// the instance's metric names and every const label gets a template
+// variable, so the dashboard works with custom namespaces, subsystems and
+// labels.
+func (ps *FiberPrometheus) WriteDashboard(w io.Writer, cfg DashboardConfig) error {
+	if cfg.Title == "" {
+		cfg.Title = "Fiber " + ps.rulePrefix()
+	}
+	if cfg.Window == "" {
+		cfg.Window = "$__rate_interval"
+	}
+
+	requests := ps.metricName("requests_total")
+	duration := ps.metricName("request_duration_seconds")
+	cache := ps.metricName("cache_results")
+	inFlight := ps.metricName("requests_in_progress_total")
+
+	sel := ps.variableSelector()
+	errSel := ps.variableSelector(`status_code=~"5.."`)
+	hitSel := ps.variableSelector(`cache_result="hit"`)
+	rate := func(metric, selector string) string {
+		return "rate(" + metric + selector + "[" + cfg.Window + "])"
+	}
+
+	panels := []dashboardPanel{
+		newDashboardPanel("Request rate", "timeseries", "reqps",
+			dashboardTarget{Expr: "sum by (method, path) (" + rate(requests, sel) + ")", LegendFormat: "{{method}} {{path}}"},
+		),
+		newDashboardPanel("Error rate", "timeseries", "percentunit",
+			dashboardTarget{Expr: "sum(" + rate(requests, errSel) + ") / sum(" + rate(requests, sel) + ")", LegendFormat: "5xx"},
+		),
+		newDashboardPanel("Latency", "timeseries", "s",
+			dashboardTarget{Expr: "histogram_quantile(0.5, sum by (le) (" + rate(duration+"_bucket", sel) + "))", LegendFormat: "p50"},
+			dashboardTarget{Expr: "histogram_quantile(0.95, sum by (le) (" + rate(duration+"_bucket", sel) + "))", LegendFormat: "p95"},
+			dashboardTarget{Expr: "histogram_quantile(0.99, sum by (le) (" + rate(duration+"_bucket", sel) + "))", LegendFormat: "p99"},
+		),
+		newDashboardPanel("Latency heatmap", "heatmap", "s",
+			dashboardTarget{Expr: "sum by (le) (increase(" + duration + "_bucket" + sel + "[" + cfg.Window + "]))", LegendFormat: "{{le}}", Format: "heatmap"},
+		),
+		newDashboardPanel("Cache hit ratio", "timeseries", "percentunit",
+			dashboardTarget{Expr: "sum by (path) (" + rate(cache, hitSel) + ") / sum by (path) (" + rate(cache, sel) + ")", LegendFormat: "{{path}}"},
+		),
+		newDashboardPanel("Requests in flight", "timeseries", "short",
+			dashboardTarget{Expr: "sum by (method) (" + inFlight + sel + ")", LegendFormat: "{{method}}"},
+		),
+	}
+	for i := range panels {
+		panels[i].ID = i + 1
+		panels[i].GridPos = map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8}
+	}
+	panels[3].Options = map[string]any{
+		"calculate": false,
+		"yAxis":     map[string]any{"unit": "s"},
+	}
+
+	variables := []dashboardVariable{{
+		Name:  "datasource",
+		Label: "Data source",
+		Type:  "datasource",
+		Query: "prometheus",
+	}}
+	for _, name := range ps.constLabelNames() {
+		variables = append(variables, dashboardVariable{
+			Name:       name,
+			Type:       "query",
+			Query:      map[string]string{"query": "label_values(" + requests + ", " + name + ")", "refId": "PrometheusVariableQueryEditor-VariableQuery"},
+			Datasource: &dashboardPrometheus,
+			Refresh:    2,
+			IncludeAll: true,
+			Multi:      true,
+			AllValue:   ".*",
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dashboard{
+		UID:           cfg.UID,
+		Title:         cfg.Title,
+		Tags:          []string{"fiber", "prometheus"},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Refresh:       "30s",
+		Time:          map[string]string{"from": "now-1h", "to": "now"},
+		Templating:    dashboardTemplating{List: variables},
+		Panels:        panels,
+	})
+}
+
+func newDashboardPanel(title, kind, unit string, targets ...dashboardTarget) dashboardPanel {
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	return dashboardPanel{
+		Title:       title,
+		Type:        kind,
+		Datasource:  dashboardPrometheus,
+		Targets:     targets,
+		FieldConfig: map[string]any{"defaults": map[string]any{"unit": unit}, "overrides": []any{}},
+	}
+}
+
+// constLabelNames returns the sorted names of the instance's const labels.
+func (ps *FiberPrometheus) constLabelNames() []string {
+	names := make([]string, 0, len(ps.constLabels))
+	for name := range ps.constLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variableSelector returns a PromQL label selector matching every const
+// label against the Grafana template variable of the same name.
+func (ps *FiberPrometheus) variableSelector(extra ...string) string {
+	names := ps.constLabelNames()
+	matchers := make([]string, 0, len(names)+len(extra))
+	for _, name := range names {
+		matchers = append(matchers, name+`=~"$`+name+`"`)
+	}
+	matchers = append(matchers, extra...)
+	return "{" + strings.Join(matchers, ",") + "}"
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteDashboard(t *testing.T) {
+	t.Parallel()
+
+	fp := NewWithLabels(map[string]string{"team": "core", "env": "prod"}, "my_app", "http")
+
+	var buf bytes.Buffer
+	if err := fp.WriteDashboard(&buf, DashboardConfig{UID: "fiber"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got dashboard
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("dashboard is not valid JSON: %v", err)
+	}
+
+	if got.Title != "Fiber my_app_http" || got.UID != "fiber" {
+		t.Errorf("got title %q and uid %q", got.Title, got.UID)
+	}
+
+	var variables []string
+	for _, v := range got.Templating.List {
+		variables = append(variables, v.Name)
+	}
+	if want := "datasource,env,team"; strings.Join(variables, ",") != want {
+		t.Errorf("got variables %v; want %s", variables, want)
+	}
+
+	want := map[string]string{
+		"Request rate":       `my_app_http_requests_total{env=~"$env",team=~"$team"}`,
+		"Error rate":         `my_app_http_requests_total{env=~"$env",team=~"$team",status_code=~"5.."}`,
+		"Latency":            `my_app_http_request_duration_seconds_bucket{env=~"$env",team=~"$team"}`,
+		"Latency heatmap":    `my_app_http_request_duration_seconds_bucket{env=~"$env",team=~"$team"}`,
+		"Cache hit ratio":    `my_app_http_cache_results{env=~"$env",team=~"$team",cache_result="hit"}`,
+		"Requests in flight": `my_app_http_requests_in_progress_total{env=~"$env",team=~"$team"}`,
+	}
+	if len(got.Panels) != len(want) {
+		t.Errorf("got %d panels; want %d", len(got.Panels), len(want))
+	}
+	for _, panel := range got.Panels {
+		selector, ok := want[panel.Title]
+		if !ok {
+			t.Errorf("unexpected panel %q", panel.Title)
+			continue
+		}
+		if len(panel.Targets) == 0 || !strings.Contains(panel.Targets[0].Expr, selector) {
+			t.Errorf("panel %q: got targets %v; want %s", panel.Title, panel.Targets, selector)
+		}
+	}
+}
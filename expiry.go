@@ -0,0 +1,173 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesExpiry deletes the request series not updated within ttl.
+type seriesExpiry struct {
+	ttl     time.Duration
+	expired prometheus.Counter
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// SetSeriesTTL deletes the series of requests_total, request_duration_seconds
+// and the header counters, such as cache_results, whose method, path and
+// status code were not requested within ttl. Long-running instances otherwise
+// keep a series for every path ever requested. The number of deleted label
+// combinations is exposed as expired_series_total.
+//
+// Expired series are swept in the background, at most every minute. A ttl of
+// zero stops the expiry. Call it before serving requests.
+func (ps *FiberPrometheus) SetSeriesTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return errors.New("fiberprometheus: negative series TTL")
+	}
+
+	var expired prometheus.Counter
+	if ps.expiry != nil {
+		expired = ps.expiry.expired
+		ps.expiry.close()
+		ps.expiry = nil
+	}
+	if ttl == 0 {
+		return nil
+	}
+
+	if expired == nil {
+		counter := prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "expired_series_total"),
+			Help:        "Count all request series deleted after not being updated within the TTL.",
+			ConstLabels: ps.instanceLabels(),
+		})
+		if err := ps.register(counter); err != nil {
+			return err
+		}
+		expired = counter
+	}
+
+	// Series created before expiry was enabled have no update time yet.
+	now := ps.clock.Now().UnixNano()
+	ps.series.paths.Range(func(_, v any) bool {
+		v.(*pathSeries).status.Range(func(_, s any) bool {
+			s.(*statusSeries).lastSeen.CompareAndSwap(0, now)
+			return true
+		})
+		return true
+	})
+
+	ps.expiry = &seriesExpiry{
+		ttl:     ttl,
+		expired: expired,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go ps.expiry.run(ps)
+	return nil
+}
+
+// run sweeps expired series until stopped.
+func (e *seriesExpiry) run(ps *FiberPrometheus) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(max(min(e.ttl/2, time.Minute), time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ps.expireSeries(e, ps.clock.Now())
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// close stops the background sweep and waits for it to return.
+func (e *seriesExpiry) close() {
+	e.once.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+}
+
+// expireSeries deletes the series last updated before now minus the TTL.
+//
+// Requests read-lock the path they update, so a series is either updated
+// before being deleted, and kept, or deleted before being updated, and the
+// request creates it again.
+func (ps *FiberPrometheus) expireSeries(e *seriesExpiry, now time.Time) {
+	cutoff := now.Add(-e.ttl).UnixNano()
+	ps.series.paths.Range(func(k, v any) bool {
+		key, p := k.(pathKey), v.(*pathSeries)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		remaining := 0
+		p.status.Range(func(status, v any) bool {
+			s := v.(*statusSeries)
+			if s.pinned.Load() || s.lastSeen.Load() >= cutoff {
+				remaining++
+				return true
+			}
+			ps.deleteSeries(s.statusCode, key.method, p.path)
+			p.status.Delete(status)
+			e.expired.Inc()
+			return true
+		})
+		if remaining == 0 {
+			p.expired = true
+			ps.series.paths.CompareAndDelete(k, v)
+		}
+		return true
+	})
+}
+
+// deleteSeries deletes a label combination from all request vectors.
+func (ps *FiberPrometheus) deleteSeries(statusCode, method, path string) {
+	ps.requestsTotal.DeleteLabelValues(statusCode, method, path)
+	ps.requestDuration.DeleteLabelValues(statusCode, method, path)
+	labels := prometheus.Labels{"status_code": statusCode, "method": method, "path": path}
+	for _, hc := range ps.headerCounters {
+		ps.deletePartialMatch(hc.counter.MetricVec, labels)
+	}
+}
+
+// lockSeries read-locks p for an update, resolving the path again when its
+// series expired while the request was handled.
+func (ps *FiberPrometheus) lockSeries(p *pathSeries, method string) *pathSeries {
+	for {
+		p.mu.RLock()
+		if !p.expired {
+			return p
+		}
+		p.mu.RUnlock()
+		p = ps.pathSeries(method, p.path)
+	}
+}
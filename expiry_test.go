@@ -0,0 +1,176 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus_test
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/fiberprometheustest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSeriesTTL(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	prometheus := fiberprometheus.New("test-service")
+	prometheus.SetClock(clock)
+	if err := prometheus.SetSeriesTTL(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prometheus.SetSeriesTTL(0) })
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	app.Get("/static", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	app.Get("/users/:id", func(c fiber.Ctx) error {
+		c.Set("X-Cache", "hit")
+		return c.SendString("Hello World")
+	})
+	prometheus.Preinitialize(app, fiber.StatusOK)
+
+	for _, path := range []string{"/", "/users/1", "/users/2"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", path, nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	clock.Advance(45 * time.Minute)
+	resp, _ := app.Test(httptest.NewRequest("GET", "/users/2", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	// Only /users/1 was not requested within the last hour.
+	clock.Advance(30 * time.Minute)
+	prometheus.ExpireSeries(clock.Now())
+
+	if got := testutil.CollectAndCount(prometheus.RequestsTotal()); got != 3 {
+		t.Errorf("got %d requests_total series; want 3", got)
+	}
+	if got := testutil.CollectAndCount(prometheus.RequestDuration()); got != 3 {
+		t.Errorf("got %d request_duration_seconds series; want 3", got)
+	}
+	if got := testutil.CollectAndCount(prometheus.CacheResults()); got != 1 {
+		t.Errorf("got %d cache_results series; want 1", got)
+	}
+	if got := testutil.ToFloat64(prometheus.ExpiredSeries()); got != 1 {
+		t.Errorf("got %v expired series; want 1", got)
+	}
+	// The preinitialized /static series is kept although never requested.
+	for path, want := range map[string]float64{"/": 1, "/static": 0, "/users/2": 2} {
+		if got := testutil.ToFloat64(prometheus.RequestsTotal().WithLabelValues("200", "GET", path)); got != want {
+			t.Errorf("%s: got %v requests; want %v", path, got, want)
+		}
+	}
+
+	// An expired path is counted again from zero.
+	resp, _ = app.Test(httptest.NewRequest("GET", "/users/1", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if got := testutil.ToFloat64(prometheus.RequestsTotal().WithLabelValues("200", "GET", "/users/1")); got != 1 {
+		t.Errorf("got %v requests; want 1", got)
+	}
+}
+
+func TestSeriesTTLNegative(t *testing.T) {
+	t.Parallel()
+
+	prometheus := fiberprometheus.New("test-service")
+	if err := prometheus.SetSeriesTTL(-time.Second); err == nil {
+		t.Error("expected an error for a negative TTL")
+	}
+}
+
+func TestSeriesTTLConcurrentRequests(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	prometheus := fiberprometheus.New("test-service")
+	prometheus.SetClock(clock)
+	if err := prometheus.SetSeriesTTL(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prometheus.SetSeriesTTL(0) })
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	h := app.Handler()
+
+	const workers, requests = 4, 500
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := &fasthttp.RequestCtx{}
+			req := &fasthttp.Request{}
+			req.Header.SetMethod(fiber.MethodGet)
+			req.SetRequestURI("/")
+			ctx.Init(req, nil, nil)
+			for j := 0; j < requests; j++ {
+				h(ctx)
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				// Everything is older than the cutoff, so every sweep
+				// deletes the series in use.
+				prometheus.ExpireSeries(clock.Now().Add(time.Hour))
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	<-swept
+
+	// Requests counted in the remaining series and in the expired ones.
+	counted := testutil.ToFloat64(prometheus.RequestsTotal().WithLabelValues("200", "GET", "/"))
+	if counted > workers*requests {
+		t.Errorf("got %v requests; want at most %d", counted, workers*requests)
+	}
+	if counted+testutil.ToFloat64(prometheus.ExpiredSeries()) == 0 {
+		t.Error("expected requests to be counted")
+	}
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Internals used by the tests of package fiberprometheus_test, which measure
+// durations with fiberprometheustest.FakeClock.
+
+type SystemClock = systemClock
+
+const UnmatchedRoute = unmatchedRoute
+
+var (
+	TraceParentID = traceParentID
+	UITemplate    = uiTemplate
+)
+
+// Clock returns the clock set with SetClock.
+func (ps *FiberPrometheus) Clock() Clock {
+	return ps.clock
+}
+
+// ExpireSeries runs a sweep of the series expiry at now.
+func (ps *FiberPrometheus) ExpireSeries(now time.Time) {
+	ps.expireSeries(ps.expiry, now)
+}
+
+// ExpiredSeries returns the expired_series_total counter.
+func (ps *FiberPrometheus) ExpiredSeries() prometheus.Counter {
+	return ps.expiry.expired
+}
+
+// CacheResults returns the cache_results counter.
+func (ps *FiberPrometheus) CacheResults() *prometheus.CounterVec {
+	return ps.cacheCounter.counter
+}
+
+// Quantile estimates the q-quantile of cumulative histogram buckets.
+func Quantile(bounds []float64, buckets []uint64, count uint64, q float64) *float64 {
+	r := &routeHistogram{bounds: bounds, buckets: buckets, count: count}
+	return r.quantile(q)
+}
@@ -0,0 +1,163 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package fiberprometheustest provides helpers to check the metrics recorded
+// by fiberprometheus in tests, without scraping and parsing the text format.
+package fiberprometheustest
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AssertRequestCount fails the test unless n requests were counted in
+// requests_total for the given method, path and status code.
+func AssertRequestCount(t testing.TB, fp *fiberprometheus.FiberPrometheus, method, path string, status, n int) {
+	t.Helper()
+
+	got := 0
+	if m, ok := find(fp, fp.RequestsTotal(), method, path, status); ok {
+		got = int(m.GetCounter().GetValue())
+	}
+	if got != n {
+		t.Errorf("requests_total{method=%q,path=%q,status_code=\"%d\"} = %d; want %d", method, path, status, got, n)
+	}
+}
+
+// AssertDurationObserved fails the test unless request_duration_seconds
+// holds observations for the given method, path and status code adding up to
+// d, within the rounding of a few float64 additions. Together with FakeClock
+// and Reset between subtests, this is the exact duration of a single
+// request.
+func AssertDurationObserved(t testing.TB, fp *fiberprometheus.FiberPrometheus, method, path string, status int, d time.Duration) {
+	t.Helper()
+
+	m, ok := find(fp, fp.RequestDuration(), method, path, status)
+	if !ok || m.GetHistogram().GetSampleCount() == 0 {
+		t.Errorf("request_duration_seconds{method=%q,path=%q,status_code=\"%d\"} has no observation", method, path, status)
+		return
+	}
+	// The middleware converts durations the same way.
+	want := float64(d.Nanoseconds()) / 1e9
+	if got := m.GetHistogram().GetSampleSum(); math.Abs(got-want) > 4*ulp(want) {
+		t.Errorf("request_duration_seconds{method=%q,path=%q,status_code=\"%d\"} sum = %gs; want %gs", method, path, status, got, want)
+	}
+}
+
+// ulp returns the distance from v to the next larger float64.
+func ulp(v float64) float64 {
+	v = math.Abs(v)
+	return math.Nextafter(v, math.Inf(1)) - v
+}
+
+// Reset clears the metrics of fp now and once the test and its subtests
+// completed, so every test case starts from zero.
+func Reset(t testing.TB, fp *fiberprometheus.FiberPrometheus) {
+	t.Helper()
+	fp.Reset()
+	t.Cleanup(fp.Reset)
+}
+
+// find returns the series of a status_code, method and path collector of fp.
+// Vectors shared with other apps also hold their series.
+func find(fp *fiberprometheus.FiberPrometheus, c prometheus.Collector, method, path string, status int) (*dto.Metric, bool) {
+	want := map[string]string{
+		"status_code": strconv.Itoa(status),
+		"method":      method,
+		"path":        path,
+	}
+	if app := fp.App(); app != "" {
+		want["app"] = app
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var found *dto.Metric
+	for metric := range ch {
+		if found != nil {
+			continue
+		}
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			continue
+		}
+		matched := 0
+		for _, label := range m.GetLabel() {
+			if v, ok := want[label.GetName()]; ok && v == label.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(want) {
+			found = m
+		}
+	}
+	return found, found != nil
+}
+
+// FakeClock is a fiberprometheus.Clock that only moves when told to, so the
+// durations recorded by the middleware are deterministic. Advance it from the
+// handler under test:
+//
+//	clock := fiberprometheustest.NewFakeClock(time.Time{})
+//	fp.SetClock(clock)
+//	app.Get("/", func(c fiber.Ctx) error {
+//		clock.Advance(25 * time.Millisecond)
+//		return c.SendStatus(fiber.StatusOK)
+//	})
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the fake time elapsed since t.
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
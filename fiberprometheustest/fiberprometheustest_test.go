@@ -0,0 +1,148 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheustest
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/iamlookod/fiberprometheus/v3"
+)
+
+// recorder captures the failures reported by the assertions.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func newApp(fp *fiberprometheus.FiberPrometheus, clock *FakeClock) *fiber.App {
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	app.Get("/slow", func(c fiber.Ctx) error {
+		clock.Advance(250 * time.Millisecond)
+		return c.SendString("Hello World")
+	})
+	app.Get("/long", func(c fiber.Ctx) error {
+		clock.Advance(1086086 * time.Microsecond)
+		return c.SendString("Hello World")
+	})
+	app.Get("/missing", func(c fiber.Ctx) error {
+		clock.Advance(time.Millisecond)
+		return fiber.ErrNotFound
+	})
+	return app
+}
+
+func TestAssertions(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.New("test-service")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+	app := newApp(fp, clock)
+
+	t.Run("slow", func(t *testing.T) {
+		Reset(t, fp)
+		for i := 0; i < 2; i++ {
+			if _, err := app.Test(httptest.NewRequest("GET", "/slow", nil)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		AssertRequestCount(t, fp, "GET", "/slow", 200, 2)
+		AssertDurationObserved(t, fp, "GET", "/slow", 200, 500*time.Millisecond)
+	})
+
+	t.Run("long", func(t *testing.T) {
+		Reset(t, fp)
+		if _, err := app.Test(httptest.NewRequest("GET", "/long", nil)); err != nil {
+			t.Fatal(err)
+		}
+		// Duration.Seconds rounds this duration differently than the middleware.
+		AssertDurationObserved(t, fp, "GET", "/long", 200, 1086086*time.Microsecond)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		Reset(t, fp)
+		if _, err := app.Test(httptest.NewRequest("GET", "/missing", nil)); err != nil {
+			t.Fatal(err)
+		}
+		AssertRequestCount(t, fp, "GET", "/missing", 404, 1)
+		AssertDurationObserved(t, fp, "GET", "/missing", 404, time.Millisecond)
+		// The previous subtest was reset.
+		AssertRequestCount(t, fp, "GET", "/slow", 200, 0)
+	})
+}
+
+func TestAssertionsFail(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.New("test-service")
+	clock := NewFakeClock(time.Time{})
+	fp.SetClock(clock)
+	app := newApp(fp, clock)
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/slow", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{TB: t}
+	AssertRequestCount(r, fp, "GET", "/slow", 200, 3)
+	AssertRequestCount(r, fp, "POST", "/slow", 200, 1)
+	AssertDurationObserved(r, fp, "GET", "/slow", 200, time.Second)
+	AssertDurationObserved(r, fp, "GET", "/slow", 500, time.Second)
+
+	want := []string{
+		`requests_total{method="GET",path="/slow",status_code="200"} = 1; want 3`,
+		`requests_total{method="POST",path="/slow",status_code="200"} = 0; want 1`,
+		`request_duration_seconds{method="GET",path="/slow",status_code="200"} sum = 0.25s; want 1s`,
+		`request_duration_seconds{method="GET",path="/slow",status_code="500"} has no observation`,
+	}
+	if len(r.errors) != len(want) {
+		t.Fatalf("got errors %q; want %q", r.errors, want)
+	}
+	for i := range want {
+		if r.errors[i] != want[i] {
+			t.Errorf("got error %q; want %q", r.errors[i], want[i])
+		}
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	t.Parallel()
+	start := time.Unix(1700000000, 0)
+	clock := NewFakeClock(start)
+
+	clock.Advance(3 * time.Second)
+	if got := clock.Since(start); got != 3*time.Second {
+		t.Errorf("got %s; want 3s", got)
+	}
+	if !clock.Now().Equal(start.Add(3 * time.Second)) {
+		t.Errorf("got %s; want %s", clock.Now(), start.Add(3*time.Second))
+	}
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/valyala/fasthttp"
+)
+
+// Query parameters of the metrics endpoint selecting a subset of the series.
+const (
+	filterNameParam  = "name[]"
+	filterMatchParam = "match[]"
+)
+
+// metricsFilter selects the gathered series matching all of its metric names
+// and any of its selectors, like the match[] parameter of federation.
+type metricsFilter struct {
+	names     map[string]bool
+	selectors []seriesSelector
+}
+
+// parseMetricsFilter reads the name[] and match[] query parameters. It returns
+// nil when the request selects all series.
+func parseMetricsFilter(args *fasthttp.Args) (*metricsFilter, error) {
+	names := args.PeekMulti(filterNameParam)
+	matches := args.PeekMulti(filterMatchParam)
+	if len(names) == 0 && len(matches) == 0 {
+		return nil, nil
+	}
+
+	filter := &metricsFilter{}
+	if len(names) > 0 {
+		filter.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			filter.names[string(name)] = true
+		}
+	}
+	for _, match := range matches {
+		selector, err := parseSelector(string(match))
+		if err != nil {
+			return nil, err
+		}
+		filter.selectors = append(filter.selectors, selector)
+	}
+	return filter, nil
+}
+
+// gatherer returns a gatherer of the series of g selected by the filter.
+func (f *metricsFilter) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		filtered := families[:0]
+		for _, family := range families {
+			if f.names != nil && !f.names[family.GetName()] {
+				continue
+			}
+			if f.selectors != nil {
+				metrics := family.Metric[:0]
+				for _, m := range family.Metric {
+					if f.selects(family.GetName(), m) {
+						metrics = append(metrics, m)
+					}
+				}
+				if len(metrics) == 0 {
+					continue
+				}
+				family.Metric = metrics
+			}
+			filtered = append(filtered, family)
+		}
+		return filtered, err
+	})
+}
+
+// selects reports whether any selector matches the series.
+func (f *metricsFilter) selects(name string, m *dto.Metric) bool {
+	for _, selector := range f.selectors {
+		if selector.matches(name, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesSelector is a parsed series selector such as
+// http_requests_total{status_code=~"5.."}.
+type seriesSelector []labelMatcher
+
+// labelMatcher matches the value of a label, the metric name being the
+// __name__ label.
+type labelMatcher struct {
+	name   string
+	negate bool
+	value  string
+	re     *regexp.Regexp
+}
+
+func (s seriesSelector) matches(name string, m *dto.Metric) bool {
+	for _, matcher := range s {
+		value := name
+		if matcher.name != "__name__" {
+			value = ""
+			for _, label := range m.GetLabel() {
+				if label.GetName() == matcher.name {
+					value = label.GetValue()
+					break
+				}
+			}
+		}
+		if !matcher.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m labelMatcher) matches(value string) bool {
+	var ok bool
+	if m.re != nil {
+		ok = m.re.MatchString(value)
+	} else {
+		ok = value == m.value
+	}
+	return ok != m.negate
+}
+
+// parseSelector parses a series selector: an optional metric name followed by
+// optional label matchers in braces, using the operators =, !=, =~ and !~ and
+// double quoted values. Regular expressions are fully anchored.
+func parseSelector(s string) (seriesSelector, error) {
+	input := s
+	var selector seriesSelector
+
+	s = strings.TrimSpace(s)
+	name, rest := splitName(s)
+	if name != "" {
+		selector = append(selector, labelMatcher{name: "__name__", value: name})
+	}
+	rest = strings.TrimSpace(rest)
+	if rest != "" {
+		if rest[0] != '{' || rest[len(rest)-1] != '}' {
+			return nil, fmt.Errorf("fiberprometheus: invalid selector %q", input)
+		}
+		rest = rest[1 : len(rest)-1]
+		for {
+			rest = strings.TrimSpace(rest)
+			if rest == "" {
+				break
+			}
+			matcher, remaining, err := parseMatcher(rest)
+			if err != nil {
+				return nil, fmt.Errorf("fiberprometheus: invalid selector %q: %w", input, err)
+			}
+			selector = append(selector, matcher)
+			remaining = strings.TrimSpace(remaining)
+			if remaining != "" && remaining[0] != ',' {
+				return nil, fmt.Errorf("fiberprometheus: invalid selector %q: expected a comma", input)
+			}
+			rest = strings.TrimPrefix(remaining, ",")
+		}
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("fiberprometheus: empty selector %q", input)
+	}
+	return selector, nil
+}
+
+// parseMatcher parses the first label matcher of s and returns the rest.
+func parseMatcher(s string) (labelMatcher, string, error) {
+	name, rest := splitName(s)
+	if name == "" || strings.Contains(name, ":") {
+		return labelMatcher{}, "", errors.New("expected a label name")
+	}
+	rest = strings.TrimSpace(rest)
+
+	matcher := labelMatcher{name: name}
+	var regex bool
+	switch {
+	case strings.HasPrefix(rest, "=~"):
+		regex, rest = true, rest[2:]
+	case strings.HasPrefix(rest, "!~"):
+		regex, matcher.negate, rest = true, true, rest[2:]
+	case strings.HasPrefix(rest, "!="):
+		matcher.negate, rest = true, rest[2:]
+	case strings.HasPrefix(rest, "="):
+		rest = rest[1:]
+	default:
+		return labelMatcher{}, "", fmt.Errorf("expected an operator after %q", name)
+	}
+
+	rest = strings.TrimSpace(rest)
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil || quoted[0] != '"' {
+		return labelMatcher{}, "", fmt.Errorf("expected a double quoted value for %q", name)
+	}
+	value, err := strconv.Unquote(quoted)
+	if err != nil {
+		return labelMatcher{}, "", err
+	}
+	matcher.value = value
+	if regex {
+		if matcher.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return labelMatcher{}, "", err
+		}
+	}
+	return matcher, rest[len(quoted):], nil
+}
+
+// splitName splits a leading metric or label name off s.
+func splitName(s string) (string, string) {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			i++
+			continue
+		}
+		break
+	}
+	return s[:i], s[i:]
+}
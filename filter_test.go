@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsFilter(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	app := fiber.New()
+	fp.RegisterAt(app, "/metrics")
+	app.Use(fp.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	app.Get("/error", func(c fiber.Ctx) error {
+		return fiber.ErrInternalServerError
+	})
+	for _, path := range []string{"/", "/error"} {
+		app.Test(httptest.NewRequest("GET", path, nil))
+	}
+
+	ok := `http_requests_total{method="GET",path="/",service="test-service",status_code="200"} 1`
+	failed := `http_requests_total{method="GET",path="/error",service="test-service",status_code="500"} 1`
+	tests := []struct {
+		query   url.Values
+		want    []string
+		notWant []string
+	}{
+		{
+			query:   url.Values{"name[]": {"http_requests_total"}},
+			want:    []string{ok, failed},
+			notWant: []string{"http_request_duration_seconds", "http_requests_in_progress_total"},
+		},
+		{
+			query:   url.Values{"name[]": {"http_requests_total", "http_requests_in_progress_total"}},
+			want:    []string{ok, "http_requests_in_progress_total"},
+			notWant: []string{"http_request_duration_seconds"},
+		},
+		{
+			query:   url.Values{"match[]": {`http_requests_total{status_code=~"5.."}`}},
+			want:    []string{failed},
+			notWant: []string{ok, "http_request_duration_seconds"},
+		},
+		{
+			query:   url.Values{"match[]": {`{__name__=~"http_requests_.*", path!="/error"}`}},
+			want:    []string{ok, "http_requests_in_progress_total"},
+			notWant: []string{failed},
+		},
+		{
+			// Series must match the names and any of the selectors.
+			query: url.Values{
+				"name[]":  {"http_request_duration_seconds"},
+				"match[]": {`{path="/"}`, `{status_code="404"}`},
+			},
+			want:    []string{`http_request_duration_seconds_count{method="GET",path="/",service="test-service",status_code="200"} 1`},
+			notWant: []string{"/error", ok},
+		},
+		{
+			// A missing label matches the empty value.
+			query:   url.Values{"match[]": {`http_requests_total{route=""}`}},
+			want:    []string{ok, failed},
+			notWant: []string{"http_request_duration_seconds"},
+		},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/metrics?"+tt.query.Encode(), nil)
+		resp, _ := app.Test(req)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		got := string(body)
+		if resp.StatusCode != 200 {
+			t.Errorf("%v: got status %d; want 200", tt.query, resp.StatusCode)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%v: got %s; want %s", tt.query, got, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(got, notWant) {
+				t.Errorf("%v: got %s; did not want %s", tt.query, got, notWant)
+			}
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics?"+url.Values{"match[]": {`{path=~"("}`}}.Encode(), nil)
+	resp, _ := app.Test(req)
+	if resp.StatusCode != 400 {
+		t.Errorf("got status %d for an invalid selector; want 400", resp.StatusCode)
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	t.Parallel()
+	valid := []string{
+		`http_requests_total`,
+		`job:http_requests:rate5m`,
+		`http_requests_total{}`,
+		`{method="GET"}`,
+		` http_requests_total { method = "GET" , path!~"/health.*", } `,
+		`{path="a \"quoted\" \\ path"}`,
+	}
+	for _, s := range valid {
+		if _, err := parseSelector(s); err != nil {
+			t.Errorf("%s: got %v; want no error", s, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`{}`,
+		`http_requests_total{`,
+		`http_requests_total{method}`,
+		`http_requests_total{method=GET}`,
+		`http_requests_total{method='GET'}`,
+		`http_requests_total{method="GET" path="/"}`,
+		`http_requests_total{method:name="GET"}`,
+		`http_requests_total{method=~"["}`,
+		`http_requests_total extra`,
+	}
+	for _, s := range invalid {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+
+	selector, _ := parseSelector(`{path="a \"quoted\" \\ path"}`)
+	if got := selector[0].value; got != `a "quoted" \ path` {
+		t.Errorf("got value %q", got)
+	}
+}
+
+func TestMetricsFilterNotRecorded(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+	fp := NewWithRegistry(registry, "test-service", "http", "", nil)
+	app := fiber.New()
+	fp.RegisterAt(app, "/metrics")
+	app.Use(fp.Middleware)
+
+	req := httptest.NewRequest("GET", "/metrics?"+url.Values{"name[]": {"http_requests_total"}}.Encode(), nil)
+	resp, _ := app.Test(req)
+	if resp.StatusCode != 200 {
+		t.Fatalf("got status %d; want 200", resp.StatusCode)
+	}
+	if got := testutil.CollectAndCount(fp.RequestsTotal()); got != 0 {
+		t.Errorf("got %d request series; want the scrape not to be recorded", got)
+	}
+}
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HeaderCounterConfig declares a counter of the values of a response header,
+// such as X-Cache, X-Upstream-Status or X-Feature-Flag.
+type HeaderCounterConfig struct {
+	// Header is the response header to read. Required.
+	Header string
+
+	// Name of the metric, prefixed with the instance's namespace and
+	// subsystem. Required.
+	Name string
+
+	// Help of the metric. Defaults to a description of the header.
+	Help string
+
+	// Label holding the header value. Defaults to "value".
+	Label string
+
+	// Normalize maps the raw header value to a label value, e.g. to fold
+	// case or strip host names. Empty results are not counted.
+	Normalize func(string) string
+
+	// Allow lists the accepted label values, after normalization. Other
+	// values are recorded as Other, or dropped if Other is empty. All values
+	// are accepted when Allow is empty.
+	Allow []string
+
+	// Other is the label value of values not in Allow.
+	Other string
+}
+
+// headerCounter counts the values of a response header by status code,
+// method and path.
+type headerCounter struct {
+	header    string
+	counter   *prometheus.CounterVec
+	normalize func(string) string
+	allow     map[string]string
+	other     string
+	hitRatio  *cacheHitRatio
+}
+
+// AddHeaderCounter registers a counter of the values of a response header, by
+// status code, method, path and header value. Responses without the header
+// are not counted.
+//
+// The cache_results counter is such a counter for the X-Cache header, see
+// CustomCacheKey.
+func (ps *FiberPrometheus) AddHeaderCounter(cfg HeaderCounterConfig) error {
+	if cfg.Header == "" || cfg.Name == "" {
+		return errors.New("fiberprometheus: header counter needs a header and a name")
+	}
+	if cfg.Help == "" {
+		cfg.Help = "Counts all " + cfg.Header + " response header values by status code, method, and path"
+	}
+	if cfg.Label == "" {
+		cfg.Label = "value"
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, cfg.Name),
+		Help:        cfg.Help,
+		ConstLabels: ps.constLabels,
+	}, ps.labelNames("status_code", "method", "path", cfg.Label))
+	if err := ps.registerVecs(&counter); err != nil {
+		return err
+	}
+
+	hc := &headerCounter{
+		header:    cfg.Header,
+		counter:   counter,
+		normalize: cfg.Normalize,
+		other:     cfg.Other,
+	}
+	hc.setAllow(cfg.Allow)
+	ps.headerCounters = append(ps.headerCounters, hc)
+	return nil
+}
+
+func (hc *headerCounter) setAllow(values []string) {
+	if len(values) == 0 {
+		hc.allow = nil
+		return
+	}
+	hc.allow = make(map[string]string, len(values))
+	for _, value := range values {
+		hc.allow[value] = value
+	}
+}
+
+// observe counts the header value of a handled request.
+func (hc *headerCounter) observe(ctx fiber.Ctx, statusCode, method, path string) {
+	value := unsafeString(ctx.Response().Header.Peek(hc.header))
+	if hc.normalize != nil && value != "" {
+		value = hc.normalize(value)
+	}
+	if value == "" {
+		return
+	}
+
+	if hc.allow != nil {
+		// Use the allowlist's copy, the header value points into the response.
+		allowed, ok := hc.allow[value]
+		if !ok {
+			if hc.other == "" {
+				return
+			}
+			allowed = hc.other
+		}
+		value = allowed
+	} else {
+		value = CopyString(value)
+	}
+	hc.counter.WithLabelValues(statusCode, method, path, value).Inc()
+	if hc.hitRatio != nil {
+		hc.hitRatio.observe(ctx, value)
+	}
+}
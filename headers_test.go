@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestAddHeaderCounter(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	err := prometheus.AddHeaderCounter(HeaderCounterConfig{
+		Header:    "X-Upstream-Status",
+		Name:      "upstream_status_results",
+		Label:     "upstream_status",
+		Normalize: strings.ToLower,
+		Allow:     []string{"ok", "degraded"},
+		Other:     "other",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = prometheus.AddHeaderCounter(HeaderCounterConfig{
+		Header: "X-Feature-Flag",
+		Name:   "feature_flag_results",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		c.Set("X-Upstream-Status", c.Query("status"))
+		c.Set("X-Feature-Flag", c.Query("flag"))
+		return c.SendString("Hello World")
+	})
+
+	for _, query := range []string{"status=OK&flag=beta", "status=Degraded", "status=exploded", "flag=beta"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/?"+query, nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	for _, want := range []string{
+		`http_upstream_status_results{method="GET",path="/?status=OK&flag=beta",service="test-service",status_code="200",upstream_status="ok"} 1`,
+		`http_upstream_status_results{method="GET",path="/?status=Degraded",service="test-service",status_code="200",upstream_status="degraded"} 1`,
+		`http_upstream_status_results{method="GET",path="/?status=exploded",service="test-service",status_code="200",upstream_status="other"} 1`,
+		`http_feature_flag_results{method="GET",path="/?flag=beta",service="test-service",status_code="200",value="beta"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+
+	notWant := `upstream_status="exploded"`
+	if strings.Contains(got, notWant) {
+		t.Errorf("Expected values outside the allowlist to be folded, but found: %s", notWant)
+	}
+}
+
+func TestAddHeaderCounterValidation(t *testing.T) {
+	t.Parallel()
+
+	prometheus := New("test-service")
+	if err := prometheus.AddHeaderCounter(HeaderCounterConfig{Name: "no_header"}); err == nil {
+		t.Error("expected an error without header")
+	}
+	if err := prometheus.AddHeaderCounter(HeaderCounterConfig{Header: "X-No-Name"}); err == nil {
+		t.Error("expected an error without name")
+	}
+	// The cache counter already uses this name.
+	if err := prometheus.AddHeaderCounter(HeaderCounterConfig{Header: "X-Cache", Name: "cache_results"}); err == nil {
+		t.Error("expected an error for a duplicate metric")
+	}
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EnableInFlightByRoute registers the requests_in_progress_by_route and
+// max_in_flight gauges, both labelled by method and route template.
+//
+// max_in_flight is a high-water mark reporting the highest number of
+// concurrent requests since the previous scrape, and is reset on each scrape,
+// including the JSON endpoint. The method-only requests_in_progress_total
+// gauge is kept as is.
+func (ps *FiberPrometheus) EnableInFlightByRoute() error {
+	if ps.inFlightByRoute {
+		return nil
+	}
+
+	tracker := &inFlightTracker{
+		currentDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(ps.namespace, ps.subsystem, "requests_in_progress_by_route"),
+			"All the requests in progress, by method and route.",
+			[]string{"method", "route"},
+			ps.instanceLabels(),
+		),
+		maxDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(ps.namespace, ps.subsystem, "max_in_flight"),
+			"Highest number of requests in progress since the previous scrape, by method and route.",
+			[]string{"method", "route"},
+			ps.instanceLabels(),
+		),
+	}
+	if err := ps.register(tracker); err != nil {
+		return err
+	}
+
+	ps.maxInFlight = tracker
+	ps.inFlightByRoute = true
+	return nil
+}
+
+// inFlightTracker is a collector exposing the current and the highest number
+// of concurrent requests per method and route. The high-water mark is reset
+// to the requests still in progress when collected.
+type inFlightTracker struct {
+	currentDesc *prometheus.Desc
+	maxDesc     *prometheus.Desc
+	slots       sync.Map // inFlightKey -> *inFlightSlot
+}
+
+type inFlightKey struct {
+	method string
+	route  string
+}
+
+type inFlightSlot struct {
+	current atomic.Int64
+	peak    atomic.Int64 // highest since the previous collection
+}
+
+// acquire marks a request as in progress. The returned slot must be released
+// once the request is done, typically with defer so that panics are covered.
+func (t *inFlightTracker) acquire(method, route string) *inFlightSlot {
+	key := inFlightKey{method: method, route: route}
+	v, ok := t.slots.Load(key)
+	if !ok {
+		v, _ = t.slots.LoadOrStore(key, &inFlightSlot{})
+	}
+	slot := v.(*inFlightSlot)
+
+	raise(&slot.peak, slot.current.Add(1))
+	return slot
+}
+
+func (s *inFlightSlot) release() {
+	s.current.Add(-1)
+}
+
+// raise sets v to n unless it is already higher.
+func raise(v *atomic.Int64, n int64) {
+	for {
+		highest := v.Load()
+		if n <= highest || v.CompareAndSwap(highest, n) {
+			return
+		}
+	}
+}
+
+// reset returns the high-water mark and starts a new one from the requests
+// still in progress.
+func (s *inFlightSlot) reset() (current, highest int64) {
+	highest = s.peak.Swap(0)
+	current = s.current.Load()
+	// Requests acquired before the swap did not raise the new mark.
+	raise(&s.peak, current)
+	return current, max(highest, current)
+}
+
+// Describe implements prometheus.Collector.
+func (t *inFlightTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.currentDesc
+	ch <- t.maxDesc
+}
+
+// Collect implements prometheus.Collector.
+func (t *inFlightTracker) Collect(ch chan<- prometheus.Metric) {
+	t.slots.Range(func(k, v any) bool {
+		key := k.(inFlightKey)
+		current, highest := v.(*inFlightSlot).reset()
+		ch <- prometheus.MustNewConstMetric(t.currentDesc, prometheus.GaugeValue, float64(current), key.method, key.route)
+		ch <- prometheus.MustNewConstMetric(t.maxDesc, prometheus.GaugeValue, float64(highest), key.method, key.route)
+		return true
+	})
+}
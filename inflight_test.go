@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/recover"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInFlightByRoute(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.EnableInFlightByRoute(); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(recover.New())
+	app.Use(prometheus.Middleware)
+
+	var during float64
+	app.Get("/users/:id", func(c fiber.Ctx) error {
+		slot, _ := prometheus.maxInFlight.slots.Load(inFlightKey{method: "GET", route: "/users/:id"})
+		during = float64(slot.(*inFlightSlot).current.Load())
+		return c.SendString("Hello World")
+	})
+	app.Get("/panic", func(c fiber.Ctx) error {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	resp, _ := app.Test(req)
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if during != 1 {
+		t.Errorf("got %v requests in flight during the request; want 1", during)
+	}
+
+	req = httptest.NewRequest("GET", "/panic", nil)
+	resp, _ = app.Test(req)
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fail()
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ = app.Test(req)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	got := string(body)
+
+	want := `http_requests_in_progress_by_route{method="GET",route="/users/:id",service="test-service"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_requests_in_progress_by_route{method="GET",route="/panic",service="test-service"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_max_in_flight{method="GET",route="/users/:id",service="test-service"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	// Scraping resets the high-water mark.
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ = app.Test(req)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	got = string(body)
+
+	want = `http_max_in_flight{method="GET",route="/users/:id",service="test-service"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestInFlightTrackerHighWaterMark(t *testing.T) {
+	t.Parallel()
+
+	prometheus := New("test-service")
+	if err := prometheus.EnableInFlightByRoute(); err != nil {
+		t.Fatal(err)
+	}
+	tracker := prometheus.maxInFlight
+
+	first := tracker.acquire("GET", "/")
+	second := tracker.acquire("GET", "/")
+	first.release()
+
+	want := `
+		# HELP http_max_in_flight Highest number of requests in progress since the previous scrape, by method and route.
+		# TYPE http_max_in_flight gauge
+		http_max_in_flight{method="GET",route="/",service="test-service"} %d
+	`
+	for i, expected := range []int{
+		2,
+		1, // reset to the requests still in progress
+		1,
+	} {
+		if err := testutil.CollectAndCompare(tracker, strings.NewReader(fmt.Sprintf(want, expected)), "http_max_in_flight"); err != nil {
+			t.Errorf("scrape %d: %v", i, err)
+		}
+	}
+	second.release()
+}
+
+func TestInFlightTrackerConcurrentReset(t *testing.T) {
+	t.Parallel()
+
+	prometheus := New("test-service")
+	if err := prometheus.EnableInFlightByRoute(); err != nil {
+		t.Fatal(err)
+	}
+	tracker := prometheus.maxInFlight
+
+	const requests = 50
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				testutil.CollectAndCount(tracker)
+			}
+		}
+	}()
+	slots := make([]*inFlightSlot, requests)
+	for i := range slots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots[i] = tracker.acquire("GET", "/")
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	// The high-water mark never drops below the requests in progress.
+	want := fmt.Sprintf(`
+		# HELP http_max_in_flight Highest number of requests in progress since the previous scrape, by method and route.
+		# TYPE http_max_in_flight gauge
+		http_max_in_flight{method="GET",route="/",service="test-service"} %d
+	`, requests)
+	if err := testutil.CollectAndCompare(tracker, strings.NewReader(want), "http_max_in_flight"); err != nil {
+		t.Error(err)
+	}
+	for _, slot := range slots {
+		slot.release()
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package cmdutil holds the flag handling shared by the fiberprometheus
+// command line tools.
+package cmdutil
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Labels collects repeated -label key=value flags.
+type Labels map[string]string
+
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value.
+func (l Labels) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("label %q is not in key=value form", value)
+	}
+	l[k] = v
+	return nil
+}
+
+// Metrics holds the flags describing how the target service created its
+// FiberPrometheus instance.
+type Metrics struct {
+	Namespace string
+	Subsystem string
+	Service   string
+	Labels    Labels
+}
+
+// RegisterFlags adds -namespace, -subsystem, -service and -label to fs.
+func (m *Metrics) RegisterFlags(fs *flag.FlagSet) {
+	m.Labels = Labels{}
+	fs.StringVar(&m.Namespace, "namespace", "http", "metric namespace, as passed to NewWith")
+	fs.StringVar(&m.Subsystem, "subsystem", "", "metric subsystem, as passed to NewWith")
+	fs.StringVar(&m.Service, "service", "", "value of the service const label")
+	fs.Var(m.Labels, "label", "additional const label as key=value, may be repeated")
+}
+
+// New returns a FiberPrometheus instance with the same metric names and
+// const labels as the target service.
+func (m *Metrics) New() *fiberprometheus.FiberPrometheus {
+	return fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), m.Service, m.Namespace, m.Subsystem, m.Labels)
+}
+
+// Write runs fn against the named file, or stdout if name is empty.
+func Write(name string, fn func(io.Writer) error) error {
+	if name == "" {
+		return fn(os.Stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
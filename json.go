@@ -0,0 +1,368 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// MetricsSnapshot is the document served by RegisterJSONAt.
+type MetricsSnapshot struct {
+	// Families are the gathered metric families, filtered by the name[] and
+	// match[] query parameters.
+	Families []JSONMetricFamily `json:"families"`
+
+	// Routes summarizes the requests of this instance per method and route.
+	Routes []RouteSummary `json:"routes"`
+}
+
+// JSONMetricFamily is a gathered metric family.
+type JSONMetricFamily struct {
+	Name    string       `json:"name"`
+	Help    string       `json:"help"`
+	Type    string       `json:"type"`
+	Metrics []JSONMetric `json:"metrics"`
+}
+
+// JSONMetric is a series of a metric family. Counters, gauges and untyped
+// metrics have a Value, histograms and summaries a Count and a Sum.
+type JSONMetric struct {
+	Labels map[string]string `json:"labels"`
+	Value  *float64          `json:"value,omitempty"`
+	Count  *uint64           `json:"count,omitempty"`
+	Sum    *float64          `json:"sum,omitempty"`
+
+	// Buckets maps the upper bounds of a histogram to cumulative counts.
+	Buckets map[string]uint64 `json:"buckets,omitempty"`
+
+	// Quantiles maps the quantiles of a summary to their values.
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+}
+
+// RouteSummary aggregates the requests of a method and route template, e.g.
+// "/users/:id", over all their paths and status codes since start. Requests
+// no route handled are summarized under the "unmatched" route. Percentiles
+// are estimated from the request duration histogram, like
+// histogram_quantile, and are nil without observations.
+type RouteSummary struct {
+	Method    string   `json:"method"`
+	Route     string   `json:"route"`
+	Count     uint64   `json:"count"`
+	Errors    uint64   `json:"errors"`
+	ErrorRate float64  `json:"error_rate"`
+	P50       *float64 `json:"p50_seconds"`
+	P95       *float64 `json:"p95_seconds"`
+	P99       *float64 `json:"p99_seconds"`
+
+	// CacheHitRatio is the share of hits among the cache hits and misses
+	// of cache_results, nil without cache lookups.
+	CacheHitRatio *float64 `json:"cache_hit_ratio,omitempty"`
+}
+
+// RegisterJSONAt registers a handler serving a MetricsSnapshot as JSON at the
+// given URL, for consumers that do not read the exposition format. It uses
+// the same gatherer, SetMetricsAuth and name[] and match[] filters as the
+// handler of RegisterAt.
+func (ps *FiberPrometheus) RegisterJSONAt(app *fiber.App, url string, handlers ...any) {
+	ps.endpointURLs = append(ps.endpointURLs, url)
+
+	h := append(handlers, ps.jsonHandler)
+	app.Get(url, func(c fiber.Ctx) error {
+		return c.Next()
+	}, h...)
+}
+
+func (ps *FiberPrometheus) jsonHandler(c fiber.Ctx) error {
+	if ok, err := ps.authorizeMetrics(c); !ok {
+		return err
+	}
+	filter, err := parseMetricsFilter(c.Request().URI().QueryArgs())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	families, err := ps.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	snapshot := MetricsSnapshot{Routes: ps.RouteSummaries()}
+	if filter != nil {
+		families, _ = filter.gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return families, nil
+		})).Gather()
+	}
+	snapshot.Families = make([]JSONMetricFamily, 0, len(families))
+	for _, family := range families {
+		snapshot.Families = append(snapshot.Families, jsonFamily(family))
+	}
+	return c.JSON(snapshot)
+}
+
+// RouteSummaries returns the request summary of each method and route
+// template, sorted by route and method.
+func (ps *FiberPrometheus) RouteSummaries() []RouteSummary {
+	return ps.summarizeRoutes()
+}
+
+// routeKey identifies the requests of one method to one route template.
+type routeKey struct {
+	method string
+	route  string
+}
+
+// routeHistogram accumulates the duration buckets of a route over its
+// status codes.
+type routeHistogram struct {
+	summary RouteSummary
+	count   uint64
+	bounds  []float64
+	buckets []uint64
+	hits    float64
+	misses  float64
+}
+
+// summarizeRoutes aggregates the request series of this instance by method
+// and route template. Only the request, duration and cache result vectors
+// are collected, not the whole registry.
+func (ps *FiberPrometheus) summarizeRoutes() []RouteSummary {
+	instance := ps.instanceLabels()
+
+	routes := make(map[routeKey]*routeHistogram)
+	route := func(labels map[string]string) *routeHistogram {
+		key := routeKey{method: labels["method"], route: ps.seriesRoute(labels["method"], labels["path"])}
+		r, ok := routes[key]
+		if !ok {
+			r = &routeHistogram{summary: RouteSummary{Method: key.method, Route: key.route}}
+			routes[key] = r
+		}
+		return r
+	}
+	each := func(c prometheus.Collector, f func(*routeHistogram, map[string]string, *dto.Metric)) {
+		for _, m := range collectMetrics(c) {
+			if labels := labelMap(m); hasLabels(labels, instance) {
+				f(route(labels), labels, m)
+			}
+		}
+	}
+
+	each(ps.requestsTotal, func(r *routeHistogram, labels map[string]string, m *dto.Metric) {
+		n := uint64(m.GetCounter().GetValue())
+		r.summary.Count += n
+		if status, _ := strconv.Atoi(labels["status_code"]); status >= 500 {
+			r.summary.Errors += n
+		}
+	})
+	each(ps.requestDuration, func(r *routeHistogram, _ map[string]string, m *dto.Metric) {
+		r.add(m.GetHistogram())
+	})
+	each(ps.cacheCounter.counter, func(r *routeHistogram, labels map[string]string, m *dto.Metric) {
+		switch labels["cache_result"] {
+		case CacheHit:
+			r.hits += m.GetCounter().GetValue()
+		case CacheMiss:
+			r.misses += m.GetCounter().GetValue()
+		}
+	})
+
+	summaries := make([]RouteSummary, 0, len(routes))
+	for _, r := range routes {
+		if r.summary.Count > 0 {
+			r.summary.ErrorRate = float64(r.summary.Errors) / float64(r.summary.Count)
+		}
+		r.summary.P50 = r.quantile(0.5)
+		r.summary.P95 = r.quantile(0.95)
+		r.summary.P99 = r.quantile(0.99)
+		if r.hits+r.misses > 0 {
+			ratio := r.hits / (r.hits + r.misses)
+			r.summary.CacheHitRatio = &ratio
+		}
+		summaries = append(summaries, r.summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Route != summaries[j].Route {
+			return summaries[i].Route < summaries[j].Route
+		}
+		return summaries[i].Method < summaries[j].Method
+	})
+	return summaries
+}
+
+// add merges the cumulative buckets of h, which share the bounds of the
+// request duration histogram.
+func (r *routeHistogram) add(h *dto.Histogram) {
+	if r.bounds == nil {
+		for _, b := range h.GetBucket() {
+			r.bounds = append(r.bounds, b.GetUpperBound())
+		}
+		r.buckets = make([]uint64, len(r.bounds))
+	}
+	for i, b := range h.GetBucket() {
+		if i < len(r.buckets) {
+			r.buckets[i] += b.GetCumulativeCount()
+		}
+	}
+	r.count += h.GetSampleCount()
+}
+
+// quantile estimates the q-quantile by linear interpolation within the
+// bucket holding it, as histogram_quantile does. Observations above the
+// highest bound are estimated at that bound.
+func (r *routeHistogram) quantile(q float64) *float64 {
+	if r.count == 0 {
+		return nil
+	}
+	rank := q * float64(r.count)
+	lower, below := 0.0, uint64(0)
+	for i, upper := range r.bounds {
+		if math.IsInf(upper, 1) {
+			break
+		}
+		if float64(r.buckets[i]) >= rank {
+			in := r.buckets[i] - below
+			value := upper
+			if in > 0 {
+				value = lower + (upper-lower)*(rank-float64(below))/float64(in)
+			}
+			return &value
+		}
+		lower, below = upper, r.buckets[i]
+	}
+	return &lower
+}
+
+// collectMetrics returns the series of c.
+func collectMetrics(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var metrics []*dto.Metric
+	for metric := range ch {
+		m := &dto.Metric{}
+		if metric.Write(m) == nil {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// labelMap returns the labels of a series by name.
+func labelMap(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, label := range m.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	return labels
+}
+
+// hasLabels reports whether labels contains all of want.
+func hasLabels(labels map[string]string, want prometheus.Labels) bool {
+	for name, value := range want {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonFamily converts a gathered metric family.
+func jsonFamily(family *dto.MetricFamily) JSONMetricFamily {
+	f := JSONMetricFamily{
+		Name:    family.GetName(),
+		Help:    family.GetHelp(),
+		Type:    jsonMetricType(family.GetType()),
+		Metrics: make([]JSONMetric, 0, len(family.GetMetric())),
+	}
+	for _, m := range family.GetMetric() {
+		metric := JSONMetric{Labels: labelMap(m)}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.Value = finite(m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			metric.Value = finite(m.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			metric.Value = finite(m.GetUntyped().GetValue())
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			h := m.GetHistogram()
+			count := h.GetSampleCount()
+			metric.Count, metric.Sum = &count, finite(h.GetSampleSum())
+			metric.Buckets = make(map[string]uint64, len(h.GetBucket()))
+			for _, b := range h.GetBucket() {
+				metric.Buckets[formatFloat(b.GetUpperBound())] = b.GetCumulativeCount()
+			}
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			count := s.GetSampleCount()
+			metric.Count, metric.Sum = &count, finite(s.GetSampleSum())
+			metric.Quantiles = make(map[string]float64, len(s.GetQuantile()))
+			for _, q := range s.GetQuantile() {
+				if v := q.GetValue(); !math.IsNaN(v) && !math.IsInf(v, 0) {
+					metric.Quantiles[formatFloat(q.GetQuantile())] = v
+				}
+			}
+		}
+		f.Metrics = append(f.Metrics, metric)
+	}
+	return f
+}
+
+// jsonMetricType returns the exposition format name of a metric type.
+func jsonMetricType(t dto.MetricType) string {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	case dto.MetricType_HISTOGRAM:
+		return "histogram"
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		return "gaugehistogram"
+	case dto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
+// finite returns a pointer to v, or nil for NaN and infinities which JSON
+// can not represent.
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// formatFloat formats a bucket bound or quantile like the exposition format.
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
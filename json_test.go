@@ -0,0 +1,268 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/fiberprometheustest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func approx(got *float64, want float64) bool {
+	return got != nil && math.Abs(*got-want) < 1e-9
+}
+
+func TestRouteSummaries(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	fp.RegisterAt(app, "/metrics")
+	fp.RegisterJSONAt(app, "/metrics.json")
+	app.Use(fp.Middleware)
+	app.Get("/fast", func(c fiber.Ctx) error {
+		clock.Advance(10 * time.Millisecond)
+		return c.SendString("fast")
+	})
+	app.Get("/slow", func(c fiber.Ctx) error {
+		clock.Advance(2 * time.Second)
+		return c.SendString("slow")
+	})
+	app.Get("/error", func(c fiber.Ctx) error {
+		clock.Advance(20 * time.Millisecond)
+		return fiber.ErrInternalServerError
+	})
+
+	for path, n := range map[string]int{"/fast": 100, "/slow": 10, "/error": 4} {
+		for range n {
+			app.Test(httptest.NewRequest("GET", path, nil))
+		}
+	}
+
+	summaries := fp.RouteSummaries()
+	if len(summaries) != 3 {
+		t.Fatalf("got %d summaries; want 3", len(summaries))
+	}
+
+	errors, fast, slow := summaries[0], summaries[1], summaries[2]
+	if errors.Route != "/error" || errors.Count != 4 || errors.Errors != 4 || errors.ErrorRate != 1 {
+		t.Errorf("got %+v for /error", errors)
+	}
+	if fast.Route != "/fast" || fast.Method != "GET" || fast.Count != 100 || fast.Errors != 0 || fast.ErrorRate != 0 {
+		t.Errorf("got %+v for /fast", fast)
+	}
+	// All observations are in the (0.005, 0.01] bucket.
+	if !approx(fast.P50, 0.0075) || !approx(fast.P95, 0.00975) || !approx(fast.P99, 0.00995) {
+		t.Errorf("got p50 %v, p95 %v, p99 %v for /fast", *fast.P50, *fast.P95, *fast.P99)
+	}
+	// All observations are in the (1, 2] bucket.
+	if !approx(slow.P50, 1.5) || !approx(slow.P99, 1.99) {
+		t.Errorf("got p50 %v, p99 %v for /slow", *slow.P50, *slow.P99)
+	}
+}
+
+func TestRouteSummariesByRoute(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	app.Get("/users/:id", func(c fiber.Ctx) error {
+		return c.SendString(c.Params("id"))
+	})
+	app.Post("/users/:id", func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	for _, target := range []string{"/users/1", "/users/2?expand=orders", "/users/2", "/missing?q=1", "/other"} {
+		app.Test(httptest.NewRequest("GET", target, nil))
+	}
+	app.Test(httptest.NewRequest("POST", "/users/3", nil))
+
+	summaries := fp.RouteSummaries()
+	if len(summaries) != 3 {
+		t.Fatalf("got %+v; want GET and POST /users/:id and unmatched", summaries)
+	}
+	get, post, unmatched := summaries[0], summaries[1], summaries[2]
+	if get.Method != "GET" || get.Route != "/users/:id" || get.Count != 3 || get.P50 == nil {
+		t.Errorf("got %+v for GET /users/:id", get)
+	}
+	if post.Method != "POST" || post.Route != "/users/:id" || post.Count != 1 {
+		t.Errorf("got %+v for POST /users/:id", post)
+	}
+	if unmatched.Route != fiberprometheus.UnmatchedRoute || unmatched.Count != 2 {
+		t.Errorf("got %+v for unmatched requests", unmatched)
+	}
+}
+
+func TestRouteSummaryQuantile(t *testing.T) {
+	t.Parallel()
+	bounds, buckets := []float64{0.1, 0.5, 1}, []uint64{0, 50, 90}
+	for q, want := range map[float64]float64{
+		0.25: 0.1 + 0.4*25/50,
+		0.5:  0.5,
+		0.9:  1,
+		0.95: 1, // above the highest bound
+	} {
+		if got := fiberprometheus.Quantile(bounds, buckets, 100, q); !approx(got, want) {
+			t.Errorf("got %v for q=%v; want %v", *got, q, want)
+		}
+	}
+	if got := fiberprometheus.Quantile(nil, nil, 0, 0.5); got != nil {
+		t.Errorf("got %v without observations; want nil", *got)
+	}
+}
+
+func TestRegisterJSONAt(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	fp.RegisterAt(app, "/metrics")
+	fp.RegisterJSONAt(app, "/metrics.json")
+	app.Use(fp.Middleware)
+	app.Get("/fast", func(c fiber.Ctx) error {
+		clock.Advance(10 * time.Millisecond)
+		return c.SendString("fast")
+	})
+	app.Get("/slow", func(c fiber.Ctx) error {
+		clock.Advance(2 * time.Second)
+		return c.SendString("slow")
+	})
+	app.Get("/error", func(c fiber.Ctx) error {
+		clock.Advance(20 * time.Millisecond)
+		return fiber.ErrInternalServerError
+	})
+
+	for path, n := range map[string]int{"/fast": 100, "/slow": 10, "/error": 4} {
+		for range n {
+			app.Test(httptest.NewRequest("GET", path, nil))
+		}
+	}
+
+	query := url.Values{"match[]": {`http_requests_total{path="/fast"}`}}
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics.json?"+query.Encode(), nil))
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), fiber.MIMEApplicationJSON) {
+		t.Fatalf("got status %d, %s; want JSON", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var snapshot fiberprometheus.MetricsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshot.Families) != 1 || len(snapshot.Families[0].Metrics) != 1 {
+		t.Fatalf("got %+v; want the /fast requests only", snapshot.Families)
+	}
+	family := snapshot.Families[0]
+	metric := family.Metrics[0]
+	if family.Name != "http_requests_total" || family.Type != "counter" ||
+		metric.Labels["service"] != "test-service" || metric.Value == nil || *metric.Value != 100 {
+		t.Errorf("got %+v", family)
+	}
+	// The summary covers all routes, whatever the filter.
+	if len(snapshot.Routes) != 3 || snapshot.Routes[1].Count != 100 || !approx(snapshot.Routes[1].P50, 0.0075) {
+		t.Errorf("got routes %+v", snapshot.Routes)
+	}
+
+	// Scrapes of the JSON endpoint are not recorded.
+	if got := testutil.ToFloat64(fp.RequestsTotal().WithLabelValues("200", "GET", "/metrics.json")); got != 0 {
+		t.Errorf("got %v JSON scrapes recorded; want 0", got)
+	}
+}
+
+func TestRegisterJSONAtHistogram(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	fp.RegisterJSONAt(app, "/metrics.json")
+	app.Use(fp.Middleware)
+	app.Get("/fast", func(c fiber.Ctx) error {
+		clock.Advance(10 * time.Millisecond)
+		return c.SendString("fast")
+	})
+	app.Get("/slow", func(c fiber.Ctx) error {
+		clock.Advance(2 * time.Second)
+		return c.SendString("slow")
+	})
+	for range 10 {
+		app.Test(httptest.NewRequest("GET", "/fast", nil))
+		app.Test(httptest.NewRequest("GET", "/slow", nil))
+	}
+
+	query := url.Values{"name[]": {"http_request_duration_seconds"}, "match[]": {`{path="/slow"}`}}
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics.json?"+query.Encode(), nil))
+	var snapshot fiberprometheus.MetricsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Families) != 1 || len(snapshot.Families[0].Metrics) != 1 {
+		t.Fatalf("got %+v; want the /slow histogram only", snapshot.Families)
+	}
+	metric := snapshot.Families[0].Metrics[0]
+	if snapshot.Families[0].Type != "histogram" || *metric.Count != 10 || !approx(metric.Sum, 20) ||
+		metric.Buckets["1"] != 0 || metric.Buckets["2"] != 10 || metric.Value != nil {
+		t.Errorf("got %+v", metric)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/metrics.json?"+url.Values{"match[]": {"{"}}.Encode(), nil))
+	if resp.StatusCode != 400 {
+		t.Errorf("got status %d for an invalid selector; want 400", resp.StatusCode)
+	}
+}
+
+func TestRegisterJSONAtAuth(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	if err := fp.SetMetricsAuth(fiberprometheus.MetricsAuthConfig{BearerToken: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	fp.RegisterJSONAt(app, "/metrics.json")
+	app.Use(fp.Middleware)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics.json", nil))
+	if resp.StatusCode != 401 {
+		t.Errorf("got status %d; want 401", resp.StatusCode)
+	}
+	req := httptest.NewRequest("GET", "/metrics.json", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != 200 {
+		t.Errorf("got status %d; want 200", resp.StatusCode)
+	}
+}
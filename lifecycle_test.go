@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewWithConfigAlreadyRegistered(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+
+	cfg := Config{Registerer: registry, ServiceName: "test-service", Namespace: "http"}
+	if _, err := NewWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewWithConfig(cfg)
+	var already prometheus.AlreadyRegisteredError
+	if !errors.As(err, &already) {
+		t.Fatalf("got %v; want an AlreadyRegisteredError", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected NewWithRegistry to panic")
+		}
+	}()
+	NewWithRegistry(registry, "test-service", "http", "", nil)
+}
+
+func TestNewWithConfigRollback(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+
+	// Taken by another library, request_duration_seconds can not be registered.
+	other := prometheus.NewCounter(prometheus.CounterOpts{Name: "http_request_duration_seconds"})
+	registry.MustRegister(other)
+	if _, err := NewWithConfig(Config{Registerer: registry, Namespace: "http"}); err == nil {
+		t.Fatal("expected a registration error")
+	}
+
+	// The collectors registered before the failure were removed again.
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "http_request_duration_seconds" {
+		t.Errorf("got %d metric families; want only the conflicting one", len(families))
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+
+	cfg := Config{Registerer: registry, ServiceName: "test-service", Namespace: "http"}
+	fp, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.SetSLO(SLOConfig{Threshold: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.EnableInFlightByRoute(); err != nil {
+		t.Fatal(err)
+	}
+	fp.Unregister()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 0 {
+		t.Errorf("got %d metric families after Unregister; want 0", len(families))
+	}
+
+	// A reloaded instance registers the same metrics again.
+	fp, err = NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.SetSLO(SLOConfig{Threshold: time.Second}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	fp := New("test-service")
+	if err := fp.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := fp.SetSeriesTTL(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expiry := fp.expiry
+	if err := fp.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := fp.Close(); err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-expiry.done:
+	default:
+		t.Error("expected the series expiry to be stopped")
+	}
+
+	// The expiry can be started again.
+	if err := fp.SetSeriesTTL(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+}
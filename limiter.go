@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/limiter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Rate limit headers set by the limiter middleware on allowed requests.
+const (
+	headerRateLimitLimit     = "X-RateLimit-Limit"
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+)
+
+// defaultKeyClass is the key_class label when no classifier is given.
+const defaultKeyClass = "default"
+
+// limiterMetrics holds the rate limiter collectors. They are registered once
+// per FiberPrometheus and shared by all instrumented limiters.
+type limiterMetrics struct {
+	rejections *prometheus.CounterVec
+	usage      *prometheus.GaugeVec
+}
+
+// InstrumentLimiter returns a copy of cfg, for use with limiter.New, that
+// counts rejected requests in limiter_rejections_total and exposes the share
+// of the bucket used by the last allowed request in limiter_bucket_usage_ratio,
+// both by route and key class.
+//
+// keyClass maps a request to a bounded class of limiter keys, e.g. "anonymous"
+// or "api_key", so the raw keys do not end up as label values. A nil keyClass
+// puts every request in the "default" class.
+//
+// The usage ratio is read from the X-RateLimit-* headers, so it is not
+// available when cfg.DisableHeaders is set.
+func (ps *FiberPrometheus) InstrumentLimiter(cfg limiter.Config, keyClass func(fiber.Ctx) string) (limiter.Config, error) {
+	metrics, err := ps.limiterCollectors()
+	if err != nil {
+		return cfg, err
+	}
+	if keyClass == nil {
+		keyClass = func(fiber.Ctx) string { return defaultKeyClass }
+	}
+
+	limitReached := cfg.LimitReached
+	if limitReached == nil {
+		limitReached = limiter.ConfigDefault.LimitReached
+	}
+	cfg.LimitReached = func(c fiber.Ctx) error {
+		metrics.rejections.WithLabelValues(ps.lookupRoute(c), keyClass(c)).Inc()
+		return limitReached(c)
+	}
+
+	inner := cfg.LimiterMiddleware
+	if inner == nil {
+		inner = limiter.ConfigDefault.LimiterMiddleware
+	}
+	cfg.LimiterMiddleware = &usageLimiter{
+		Handler:  inner,
+		ps:       ps,
+		metrics:  metrics,
+		keyClass: keyClass,
+	}
+	return cfg, nil
+}
+
+// limiterCollectors registers the rate limiter collectors on first use.
+func (ps *FiberPrometheus) limiterCollectors() (*limiterMetrics, error) {
+	if ps.limiterMetrics != nil {
+		return ps.limiterMetrics, nil
+	}
+
+	metrics := &limiterMetrics{
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "limiter_rejections_total"),
+			Help:        "Count all requests rejected by the rate limiter by route and key class.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("route", "key_class")),
+		usage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "limiter_bucket_usage_ratio"),
+			Help:        "Share of the rate limiter bucket used by the last allowed request, by route and key class.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("route", "key_class")),
+	}
+	if err := ps.registerVecs(&metrics.rejections, &metrics.usage); err != nil {
+		return nil, err
+	}
+
+	ps.limiterMetrics = metrics
+	return metrics, nil
+}
+
+// usageLimiter wraps a limiter algorithm to read the rate limit headers it
+// sets once the request has been handled.
+type usageLimiter struct {
+	limiter.Handler
+
+	ps       *FiberPrometheus
+	metrics  *limiterMetrics
+	keyClass func(fiber.Ctx) string
+}
+
+// New implements limiter.Handler.
+func (u *usageLimiter) New(cfg *limiter.Config) fiber.Handler {
+	next := u.Handler.New(cfg)
+	return func(c fiber.Ctx) error {
+		err := next(c)
+
+		limit, _ := strconv.Atoi(c.GetRespHeader(headerRateLimitLimit))
+		remaining, convErr := strconv.Atoi(c.GetRespHeader(headerRateLimitRemaining))
+		if limit > 0 && convErr == nil {
+			u.metrics.usage.WithLabelValues(u.ps.lookupRoute(c), u.keyClass(c)).Set(float64(limit-remaining) / float64(limit))
+		}
+		return err
+	}
+}
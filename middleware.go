@@ -22,7 +22,8 @@
 package fiberprometheus
 
 import (
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"unsafe"
@@ -30,21 +31,45 @@ import (
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/adaptor"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // FiberPrometheus ...
 type FiberPrometheus struct {
+	registerer        prometheus.Registerer
 	gatherer          prometheus.Gatherer
+	namespace         string
+	subsystem         string
+	constLabels       prometheus.Labels
 	requestsTotal     *prometheus.CounterVec
 	requestDuration   *prometheus.HistogramVec
 	requestInFlight   *prometheus.GaugeVec
-	cacheHeaderKey    string
-	cacheCounter      *prometheus.CounterVec
+	cacheCounter      *headerCounter
+	headerCounters    []*headerCounter
 	defaultURL        string
 	skipPaths         map[string]bool
 	ignoreStatusCodes map[int]bool
+	queueHeaderKey    string
+	queueDuration     *prometheus.HistogramVec
+	inFlightByRoute   bool
+	maxInFlight       *inFlightTracker
+	routeTables       sync.Map // *fiber.App -> *routeTable
+	slo               *sloTracker
+	clientMetrics     *clientMetrics
+	upstreamMetrics   *upstreamMetrics
+	limiterMetrics    *limiterMetrics
+	timeoutsTotal     *prometheus.CounterVec
+	connections       *connectionMetrics
+	clock             Clock
+	collectors        []prometheus.Collector
+	app               string
+	shared            map[*prometheus.MetricVec]*prometheus.MetricVec // curried -> base
+	series            seriesCache
+	expiry            *seriesExpiry
+	servers           []*MetricsServer
+	metricsAuth       *metricsAuth
+	endpointURLs      []string
+	slowRequests      *slowRequestTracker
 }
 
 func CopyString(s string) string {
@@ -60,7 +85,88 @@ func UnsafeBytes(s string) []byte {
 
 const MaxStringLen = 0x7fff0000
 
-func create(registry prometheus.Registerer, serviceName, namespace, subsystem string, labels map[string]string) *FiberPrometheus {
+// defaultBuckets spans 1ns to 30s so that both in-process handlers and slow
+// upstream calls land in a meaningful bucket.
+var defaultBuckets = []float64{
+	0.000000001, // 1ns
+	0.000000002,
+	0.000000005,
+	0.00000001, // 10ns
+	0.00000002,
+	0.00000005,
+	0.0000001, // 100ns
+	0.0000002,
+	0.0000005,
+	0.000001, // 1µs
+	0.000002,
+	0.000005,
+	0.00001, // 10µs
+	0.00002,
+	0.00005,
+	0.0001, // 100µs
+	0.0002,
+	0.0005,
+	0.001, // 1ms
+	0.002,
+	0.005,
+	0.01, // 10ms
+	0.02,
+	0.05,
+	0.1, // 100 ms
+	0.2,
+	0.5,
+	1.0, // 1s
+	2.0,
+	5.0,
+	10.0, // 10s
+	15.0,
+	20.0,
+	30.0,
+}
+
+// Config configures a FiberPrometheus built with NewWithConfig.
+type Config struct {
+	// Registerer the collectors are registered with. A new registry is used
+	// when nil.
+	Registerer prometheus.Registerer
+	// ServiceName is added to all metrics as the "service" const label,
+	// unless empty.
+	ServiceName string
+	// Namespace and Subsystem prefix the metric names.
+	Namespace string
+	Subsystem string
+	// Labels are added to all metrics as const labels.
+	Labels map[string]string
+	// App enables the shared-collector mode when set, for several apps or
+	// instances in one process. The metric vectors get an "app" label with
+	// this value, and instances of the same names on the same Registerer
+	// reuse the vectors registered first instead of failing with a
+	// prometheus.AlreadyRegisteredError, so one /metrics serves all apps.
+	// Other collectors, such as the in-flight tracker, carry "app" as a
+	// const label.
+	//
+	// Instances sharing a Registerer must all set App, with distinct values.
+	App string
+}
+
+// NewWithConfig creates a new instance of FiberPrometheus middleware from
+// cfg. Unlike the other constructors, which panic, it returns the error of
+// a failed registration, e.g. a prometheus.AlreadyRegisteredError when the
+// registry already holds metrics of the same names.
+func NewWithConfig(cfg Config) (*FiberPrometheus, error) {
+	return create(cfg.Registerer, cfg.ServiceName, cfg.Namespace, cfg.Subsystem, cfg.Labels, cfg.App)
+}
+
+// mustCreate is create for the constructors without an error result.
+func mustCreate(registry prometheus.Registerer, serviceName, namespace, subsystem string, labels map[string]string) *FiberPrometheus {
+	ps, err := create(registry, serviceName, namespace, subsystem, labels, "")
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+func create(registry prometheus.Registerer, serviceName, namespace, subsystem string, labels map[string]string, app string) (*FiberPrometheus, error) {
 	if registry == nil {
 		registry = prometheus.NewRegistry()
 	}
@@ -73,102 +179,155 @@ func create(registry prometheus.Registerer, serviceName, namespace, subsystem st
 		constLabels[label] = value
 	}
 
-	counter := promauto.With(registry).NewCounterVec(
+	// If the registerer is also a gatherer, use it, falling back to the
+	// DefaultGatherer.
+	gatherer, ok := registry.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+
+	ps := &FiberPrometheus{
+		registerer:  registry,
+		gatherer:    gatherer,
+		namespace:   namespace,
+		subsystem:   subsystem,
+		constLabels: constLabels,
+		app:         app,
+		shared:      make(map[*prometheus.MetricVec]*prometheus.MetricVec),
+		defaultURL:  "/metrics",
+		clock:       systemClock{},
+	}
+
+	counter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name:        prometheus.BuildFQName(namespace, subsystem, "requests_total"),
 			Help:        "Count all http requests by status code, method and path.",
 			ConstLabels: constLabels,
 		},
-		[]string{"status_code", "method", "path"},
+		ps.labelNames("status_code", "method", "path"),
 	)
 
-	cacheCounter := promauto.With(registry).NewCounterVec(
+	cacheCounter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name:        prometheus.BuildFQName(namespace, subsystem, "cache_results"),
 			Help:        "Counts all cache hits by status code, method, and path",
 			ConstLabels: constLabels,
 		},
-		[]string{"status_code", "method", "path", "cache_result"},
+		ps.labelNames("status_code", "method", "path", "cache_result"),
 	)
 
-	histogram := promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:        prometheus.BuildFQName(namespace, subsystem, "request_duration_seconds"),
 		Help:        "Duration of all HTTP requests by status code, method and path.",
 		ConstLabels: constLabels,
-		Buckets: []float64{
-			0.000000001, // 1ns
-			0.000000002,
-			0.000000005,
-			0.00000001, // 10ns
-			0.00000002,
-			0.00000005,
-			0.0000001, // 100ns
-			0.0000002,
-			0.0000005,
-			0.000001, // 1µs
-			0.000002,
-			0.000005,
-			0.00001, // 10µs
-			0.00002,
-			0.00005,
-			0.0001, // 100µs
-			0.0002,
-			0.0005,
-			0.001, // 1ms
-			0.002,
-			0.005,
-			0.01, // 10ms
-			0.02,
-			0.05,
-			0.1, // 100 ms
-			0.2,
-			0.5,
-			1.0, // 1s
-			2.0,
-			5.0,
-			10.0, // 10s
-			15.0,
-			20.0,
-			30.0,
-		},
+		Buckets:     defaultBuckets,
 	},
-		[]string{"status_code", "method", "path"},
+		ps.labelNames("status_code", "method", "path"),
 	)
 
-	gauge := promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:        prometheus.BuildFQName(namespace, subsystem, "requests_in_progress_total"),
 		Help:        "All the requests in progress",
 		ConstLabels: constLabels,
-	}, []string{"method"})
+	}, ps.labelNames("method"))
 
-	// If the registerer is also a gatherer, use it, falling back to the
-	// DefaultGatherer.
-	gatherer, ok := registry.(prometheus.Gatherer)
-	if !ok {
-		gatherer = prometheus.DefaultGatherer
+	// Leave the registry as it was on failure, so a retry can succeed.
+	if err := ps.registerVecs(&counter, &cacheCounter, &histogram, &gauge); err != nil {
+		return nil, err
 	}
 
-	return &FiberPrometheus{
-		gatherer:        gatherer,
-		requestsTotal:   counter,
-		requestDuration: histogram,
-		requestInFlight: gauge,
-		cacheHeaderKey:  "X-Cache",
-		cacheCounter:    cacheCounter,
-		defaultURL:      "/metrics",
+	cache := &headerCounter{
+		header:    "X-Cache",
+		counter:   cacheCounter,
+		normalize: NormalizeCacheResult,
+		other:     CacheOther,
 	}
+	cache.setAllow(defaultCacheResults)
+
+	ps.requestsTotal = counter
+	ps.requestDuration = histogram
+	ps.requestInFlight = gauge
+	ps.cacheCounter = cache
+	ps.headerCounters = []*headerCounter{cache}
+	return ps, nil
+}
+
+// register adds an optional collector to the instance's registerer.
+func (ps *FiberPrometheus) register(c prometheus.Collector) error {
+	if err := ps.registerer.Register(c); err != nil {
+		return err
+	}
+	ps.collectors = append(ps.collectors, c)
+	return nil
+}
+
+// RequestsTotal returns the requests_total counter, labelled by status code,
+// method and path.
+func (ps *FiberPrometheus) RequestsTotal() *prometheus.CounterVec {
+	return ps.requestsTotal
+}
+
+// RequestDuration returns the request_duration_seconds histogram, labelled by
+// status code, method and path.
+func (ps *FiberPrometheus) RequestDuration() *prometheus.HistogramVec {
+	return ps.requestDuration
+}
+
+// Reset deletes all series of the metrics of this instance, so tests can
+// start each case from zero. Call it while no request is in flight, the
+// in-progress gauges would otherwise go negative.
+func (ps *FiberPrometheus) Reset() {
+	ps.series.reset()
+	ps.deleteAppSeries()
+	for _, c := range ps.collectors {
+		if r, ok := c.(interface{ Reset() }); ok {
+			r.Reset()
+		}
+	}
+}
+
+// Unregister removes all collectors of this instance, including those of
+// optional features, from its registerer, so another instance can register
+// metrics of the same names. The instance must not be used afterwards.
+//
+// In shared mode the vectors stay registered for the other apps, only the
+// series of this instance's app are deleted from them.
+func (ps *FiberPrometheus) Unregister() {
+	ps.deleteAppSeries()
+	clear(ps.shared)
+	for _, c := range ps.collectors {
+		ps.registerer.Unregister(c)
+	}
+	ps.collectors = nil
+}
+
+// Close stops the background goroutines of this instance, such as the
+// series expiry of SetSeriesTTL, and shuts down the servers started by
+// ServeMetrics. It does not unregister the collectors. Close is idempotent
+// and returns the first shutdown error.
+func (ps *FiberPrometheus) Close() error {
+	if ps.expiry != nil {
+		ps.expiry.close()
+	}
+	var err error
+	for _, s := range ps.servers {
+		if closeErr := s.close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 // CustomCacheKey allows to set a custom header key for caching
 // By default it is set to "X-Cache", the fiber default
 func (ps *FiberPrometheus) CustomCacheKey(cacheHeaderKey string) {
-	ps.cacheHeaderKey = cacheHeaderKey
+	ps.cacheCounter.header = cacheHeaderKey
 }
 
 // New creates a new instance of FiberPrometheus middleware
 // serviceName is available as a const label
 func New(serviceName string) *FiberPrometheus {
-	return create(nil, serviceName, "http", "", nil)
+	return mustCreate(nil, serviceName, "http", "", nil)
 }
 
 // NewWith creates a new instance of FiberPrometheus middleware but with an ability
@@ -179,7 +338,7 @@ func New(serviceName string) *FiberPrometheus {
 // For e.g. namespace = "my_app", subsystem = "http" then metrics would be
 // `my_app_http_requests_total{...,service= "serviceName"}`
 func NewWith(serviceName, namespace, subsystem string) *FiberPrometheus {
-	return create(nil, serviceName, namespace, subsystem, nil)
+	return mustCreate(nil, serviceName, namespace, subsystem, nil)
 }
 
 // NewWithLabels creates a new instance of FiberPrometheus middleware but with an ability
@@ -191,7 +350,7 @@ func NewWith(serviceName, namespace, subsystem string) *FiberPrometheus {
 // then then metrics would become
 // `my_app_http_requests_total{...,key1= "value1", key2= "value2" }`
 func NewWithLabels(labels map[string]string, namespace, subsystem string) *FiberPrometheus {
-	return create(nil, "", namespace, subsystem, labels)
+	return mustCreate(nil, "", namespace, subsystem, labels)
 }
 
 // NewWithRegistry creates a new instance of FiberPrometheus middleware but with an ability
@@ -202,20 +361,64 @@ func NewWithLabels(labels map[string]string, namespace, subsystem string) *Fiber
 // For e.g. namespace = "my_app", subsystem = "http" and labels = map[string]string{"key1": "value1", "key2":"value2"}
 // then then metrics would become
 // `my_app_http_requests_total{...,key1= "value1", key2= "value2" }`
+//
+// It panics when the metrics can not be registered, e.g. because the registry
+// already holds metrics of the same names. Use NewWithConfig to get an error.
 func NewWithRegistry(registry prometheus.Registerer, serviceName, namespace, subsystem string, labels map[string]string) *FiberPrometheus {
-	return create(registry, serviceName, namespace, subsystem, labels)
+	return mustCreate(registry, serviceName, namespace, subsystem, labels)
 }
 
 // RegisterAt will register the prometheus handler at a given URL
+//
+// Like Prometheus federation, the handler can serve a subset of the series:
+// ?name[]=http_requests_total keeps the named metrics and
+// ?match[]=http_requests_total{status_code=~"5.."} the series matching any
+// of the selectors. Both parameters can be repeated.
 func (ps *FiberPrometheus) RegisterAt(app *fiber.App, url string, handlers ...any) {
 	ps.defaultURL = url
 
-	h := append(handlers, adaptor.HTTPHandler(promhttp.HandlerFor(ps.gatherer, promhttp.HandlerOpts{})))
+	h := append(handlers, ps.metricsHandler())
 	app.Get(ps.defaultURL, func(c fiber.Ctx) error {
 		return c.Next()
 	}, h...)
 }
 
+// metricsHandler serves the metrics of the gatherer in the exposition format.
+// The name[] and match[] query parameters select a subset of the series, see
+// RegisterAt.
+func (ps *FiberPrometheus) metricsHandler() fiber.Handler {
+	handler := adaptor.HTTPHandler(promhttp.HandlerFor(ps.gatherer, promhttp.HandlerOpts{}))
+	return func(c fiber.Ctx) error {
+		if ok, err := ps.authorizeMetrics(c); !ok {
+			return err
+		}
+		filter, err := parseMetricsFilter(c.Request().URI().QueryArgs())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		if filter != nil {
+			gatherer := filter.gatherer(ps.gatherer)
+			return adaptor.HTTPHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))(c)
+		}
+		return handler(c)
+	}
+}
+
+// isMetricsPath reports whether the request URI is one of the metrics
+// endpoints, whatever its query, so scrapes are not recorded.
+func (ps *FiberPrometheus) isMetricsPath(uri string) bool {
+	path, _, _ := strings.Cut(uri, "?")
+	if path == ps.defaultURL {
+		return true
+	}
+	for _, url := range ps.endpointURLs {
+		if path == url {
+			return true
+		}
+	}
+	return false
+}
+
 // SetSkipPaths allows to set the paths that should be skipped from the metrics
 func (ps *FiberPrometheus) SetSkipPaths(paths []string) {
 	if ps.skipPaths == nil {
@@ -226,6 +429,46 @@ func (ps *FiberPrometheus) SetSkipPaths(paths []string) {
 	}
 }
 
+// recordRequest updates the request counters and the duration histogram of
+// a request. While expiry is enabled the series are read-locked until they
+// are updated, so they are not deleted in between. It returns the request
+// duration, and false for long-lived connections which observe none.
+func (ps *FiberPrometheus) recordRequest(ctx fiber.Ctx, series *pathSeries, method string, status int, start time.Time) (time.Duration, bool) {
+	// Update total requests counter
+	if ps.expiry != nil {
+		series = ps.lockSeries(series, method)
+		defer series.mu.RUnlock()
+	}
+	path := series.path
+	labels := ps.statusSeries(series, status)
+	if ps.expiry != nil {
+		labels.lastSeen.Store(start.UnixNano())
+	}
+	ps.requestsTotal.WithLabelValues(labels.statusCode, method, path).Inc()
+	series.setRoute(ctx)
+
+	// Update the cache and other header counters
+	for _, hc := range ps.headerCounters {
+		hc.observe(ctx, labels.statusCode, method, path)
+	}
+
+	// Long-lived connections are tracked on their own, a single sample
+	// lasting hours would distort the request duration percentiles.
+	if ps.connections != nil {
+		longLived := isLongLived(ctx, status)
+		ps.trackConnection(ctx, longLived)
+		if longLived {
+			return 0, false
+		}
+	}
+
+	// Update the request duration histogram
+	duration := ps.clock.Since(start)
+	elapsed := float64(duration.Nanoseconds()) / 1e9
+	ps.requestDuration.WithLabelValues(labels.statusCode, method, path).Observe(elapsed)
+	return duration, true
+}
+
 // SetIgnoreStatusCodes allows ignoring specific status codes from being recorded in metrics
 func (ps *FiberPrometheus) SetIgnoreStatusCodes(codes []int) {
 	if ps.ignoreStatusCodes == nil {
@@ -236,60 +479,88 @@ func (ps *FiberPrometheus) SetIgnoreStatusCodes(codes []int) {
 	}
 }
 
+// responseStatus returns the status code of a request handled with err.
+func responseStatus(ctx fiber.Ctx, err error) int {
+	if err == nil {
+		return ctx.Response().StatusCode()
+	}
+	// initialize with default error code
+	// https://docs.gofiber.io/guide/error-handling
+	status := fiber.StatusInternalServerError
+	if e, ok := err.(*fiber.Error); ok {
+		// Get correct error code from fiber.Error type
+		status = e.Code
+	}
+	return status
+}
+
 // Middleware is the actual default middleware implementation
 func (ps *FiberPrometheus) Middleware(ctx fiber.Ctx) error {
-	start := time.Now()
-	path := string(ctx.Request().RequestURI())
+	start := ps.clock.Now()
+	path := unsafeString(ctx.Request().RequestURI())
 
-	if path == ps.defaultURL {
+	if ps.isMetricsPath(path) {
 
 		return ctx.Next()
 	}
 
 	method := ctx.Route().Method
-	ps.requestInFlight.WithLabelValues(method).Inc()
-	defer func() {
-		ps.requestInFlight.WithLabelValues(method).Dec()
-	}()
-
-	err := ctx.Next()
-	// initialize with default error code
-	// https://docs.gofiber.io/guide/error-handling
-	status := fiber.StatusInternalServerError
-	if err != nil {
-		if e, ok := err.(*fiber.Error); ok {
-			// Get correct error code from fiber.Error type
-			status = e.Code
-		}
+	// Copy the path before the handler runs, it may rewrite the request.
+	// Known paths reuse their cached copy, new ones are only cached once a
+	// request to them is recorded.
+	series := ps.loadPathSeries(method, path)
+	if series != nil {
+		path = series.path
 	} else {
-		status = ctx.Response().StatusCode()
+		path = CopyString(path)
+	}
+	if ps.queueDuration != nil {
+		if header := ctx.Get(ps.queueHeaderKey); header != "" {
+			ps.observeQueueTime(header, method, start)
+		}
+	}
+
+	// Resolve the in-flight gauge once, so the deferred decrement always
+	// hits the series that was incremented, even on panics.
+	inFlight := ps.inFlightGauge(method)
+	inFlight.Inc()
+	defer inFlight.Dec()
+	if ps.inFlightByRoute {
+		slot := ps.maxInFlight.acquire(method, ps.lookupRoute(ctx))
+		defer slot.release()
 	}
 
+	err := ctx.Next()
+	status := responseStatus(ctx, err)
+
 	// Check if the normalized path should be skipped
 	if ps.skipPaths[path] {
 		return err
 	}
 
-	// Get status as string
-	statusCode := strconv.Itoa(status)
-
 	// Skip metrics for ignored status codes
 	if ps.ignoreStatusCodes[status] {
 		return err
 	}
 
-	// Update total requests counter
-	ps.requestsTotal.WithLabelValues(statusCode, method, path).Inc()
+	if series == nil {
+		series = ps.pathSeries(method, path)
+	}
+	duration, observed := ps.recordRequest(ctx, series, method, status, start)
+	if !observed {
+		return err
+	}
 
-	// Update the cache counter
-	cacheResult := CopyString(ctx.GetRespHeader(ps.cacheHeaderKey, ""))
-	if cacheResult != "" {
-		ps.cacheCounter.WithLabelValues(statusCode, method, path, cacheResult).Inc()
+	// The hooks below run outside the series lock, they may take a while.
+	// Report slow requests with the duration measured above
+	if ps.slowRequests != nil {
+		ps.slowRequests.observe(ctx, method, path, status, duration, start.Add(duration))
 	}
 
-	// Update the request duration histogram
-	elapsed := float64(time.Since(start).Nanoseconds()) / 1e9
-	ps.requestDuration.WithLabelValues(statusCode, method, path).Observe(elapsed)
+	// Update the SLO counters
+	if ps.slo != nil {
+		ps.slo.observe(ctx, status, duration)
+	}
 
 	return err
 }
@@ -27,8 +27,10 @@ import (
 	"fmt"
 	"io"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/basicauth"
@@ -36,6 +38,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/valyala/fasthttp"
 )
 
@@ -751,6 +754,37 @@ func TestSetIgnoreStatusCodes(t *testing.T) {
 	}
 }
 
+func TestSkippedRequestsAreNotCached(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	prometheus.SetSkipPaths([]string{"/health"})
+	prometheus.SetIgnoreStatusCodes([]int{fiber.StatusNotFound})
+	app.Use(prometheus.Middleware)
+	app.Get("/health", func(c fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	for i := range 100 {
+		app.Test(httptest.NewRequest("GET", "/scan/"+strconv.Itoa(i), nil))
+		app.Test(httptest.NewRequest("GET", "/health", nil))
+	}
+	app.Test(httptest.NewRequest("GET", "/", nil))
+
+	cached := 0
+	prometheus.series.paths.Range(func(_, _ any) bool {
+		cached++
+		return true
+	})
+	if cached != 1 {
+		t.Errorf("got %d cached paths; want only the recorded /", cached)
+	}
+}
+
 func TestSetSkipPathsMultipleCalls(t *testing.T) {
 	t.Parallel()
 
@@ -787,6 +821,118 @@ func TestSetIgnoreStatusCodesMultipleCalls(t *testing.T) {
 	}
 }
 
+func TestReset(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.SetSLO(SLOConfig{Threshold: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if got := testutil.CollectAndCount(prometheus.RequestsTotal()); got != 1 {
+		t.Fatalf("got %d series; want 1", got)
+	}
+
+	prometheus.Reset()
+	if got := testutil.CollectAndCount(prometheus.RequestsTotal()); got != 0 {
+		t.Errorf("got %d requests_total series after Reset; want 0", got)
+	}
+	if got := testutil.CollectAndCount(prometheus.RequestDuration()); got != 0 {
+		t.Errorf("got %d request_duration_seconds series after Reset; want 0", got)
+	}
+	if got := testutil.CollectAndCount(prometheus.slo.counter); got != 0 {
+		t.Errorf("got %d requests_slo_total series after Reset; want 0", got)
+	}
+
+	// Requests after a Reset are recorded in new series.
+	resp, _ = app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if got := testutil.ToFloat64(prometheus.RequestsTotal().WithLabelValues("200", "GET", "/")); got != 1 {
+		t.Errorf("got %v requests after Reset; want 1", got)
+	}
+}
+
+func TestMiddlewareVectorReset(t *testing.T) {
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	// Requests after the vectors were reset or had series deleted are
+	// recorded in new series.
+	prometheus.RequestsTotal().Reset()
+	prometheus.RequestDuration().DeleteLabelValues("200", "GET", "/")
+	resp, _ = app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if got := testutil.ToFloat64(prometheus.RequestsTotal().WithLabelValues("200", "GET", "/")); got != 1 {
+		t.Errorf("got %v requests after Reset; want 1", got)
+	}
+	if got := testutil.CollectAndCount(prometheus.RequestDuration()); got != 1 {
+		t.Errorf("got %d request_duration_seconds series after Delete; want 1", got)
+	}
+}
+
+func TestMiddlewareAllocations(t *testing.T) {
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	handler := app.Handler()
+	// Without the middleware, to subtract the allocations of fiber itself.
+	plain := fiber.New()
+	plain.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	baseline := plain.Handler()
+
+	ctx := &fasthttp.RequestCtx{}
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(fiber.MethodGet)
+	req.SetRequestURI("/")
+	ctx.Init(req, nil, nil)
+
+	// The first request creates the series.
+	handler(ctx)
+	allocs := testing.AllocsPerRun(100, func() { handler(ctx) })
+	allocs -= testing.AllocsPerRun(100, func() { baseline(ctx) })
+	if allocs > 0 {
+		t.Errorf("got %v allocations per request; want 0", allocs)
+	}
+	// AllocsPerRun makes one warm-up call on top of the 100 runs.
+	if got := testutil.ToFloat64(prometheus.RequestsTotal().WithLabelValues("200", "GET", "/")); got != 102 {
+		t.Errorf("got %v requests; want 102", got)
+	}
+}
+
+// Both benchmarks report 0 allocs/op once the series of the request exist:
+//
+//	Benchmark_Middleware            ~940ns/op   0 B/op   0 allocs/op
+//	Benchmark_Middleware_Parallel   ~830ns/op   0 B/op   0 allocs/op
 func Benchmark_Middleware(b *testing.B) {
 	app := fiber.New()
 
@@ -802,7 +948,7 @@ func Benchmark_Middleware(b *testing.B) {
 	ctx := &fasthttp.RequestCtx{}
 
 	req := &fasthttp.Request{}
-	req.Header.SetMethod(fiber.MethodOptions)
+	req.Header.SetMethod(fiber.MethodGet)
 	req.SetRequestURI("/")
 	ctx.Init(req, nil, nil)
 
@@ -833,8 +979,8 @@ func Benchmark_Middleware_Parallel(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		ctx := &fasthttp.RequestCtx{}
 		req := &fasthttp.Request{}
-		req.Header.SetMethod(fiber.MethodOptions)
-		req.SetRequestURI("/metrics")
+		req.Header.SetMethod(fiber.MethodGet)
+		req.SetRequestURI("/")
 		ctx.Init(req, nil, nil)
 
 		for pb.Next() {
@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import "github.com/gofiber/fiber/v3"
+
+// DefaultPreinitializeStatusCodes are the status codes Preinitialize creates
+// series for when none are given.
+var DefaultPreinitializeStatusCodes = []int{
+	fiber.StatusOK,
+	fiber.StatusBadRequest,
+	fiber.StatusNotFound,
+	fiber.StatusInternalServerError,
+}
+
+// Preinitialize creates zero-valued series for the routes registered on app,
+// so rate() has a starting point and absent() alerts work right after a
+// deploy. Call it once all routes are registered.
+//
+// requests_total and request_duration_seconds get a series per method and
+// status code, by default DefaultPreinitializeStatusCodes, of every static
+// route. Routes with parameters or wildcards are left out, their path label
+// holds the requested path, which is not known in advance. When SetSLO was
+// called, requests_slo_total gets a series per result for every route with a
+// threshold.
+//
+// The metrics endpoint, skipped paths and ignored status codes are left out.
+// Preinitialized series never expire, see SetSeriesTTL.
+func (ps *FiberPrometheus) Preinitialize(app *fiber.App, statusCodes ...int) {
+	if len(statusCodes) == 0 {
+		statusCodes = DefaultPreinitializeStatusCodes
+	}
+
+	for _, route := range app.GetRoutes(true) {
+		if route.Path == ps.defaultURL || ps.skipPaths[route.Path] {
+			continue
+		}
+		if ps.slo != nil {
+			ps.slo.preinitialize(route)
+		}
+		if !isStaticRoute(route) {
+			continue
+		}
+
+		series := ps.pathSeries(route.Method, route.Path)
+		for _, status := range statusCodes {
+			if ps.ignoreStatusCodes[status] {
+				continue
+			}
+			labels := ps.statusSeries(series, status)
+			labels.pinned.Store(true)
+			ps.requestsTotal.WithLabelValues(labels.statusCode, route.Method, series.path)
+			ps.requestDuration.WithLabelValues(labels.statusCode, route.Method, series.path)
+		}
+	}
+}
+
+// preinitialize creates the zero-valued series of route.
+func (s *sloTracker) preinitialize(route fiber.Route) {
+	if s.threshold(route.Method, route.Path, route.Name) <= 0 {
+		return
+	}
+	for _, result := range []string{SLOSatisfied, SLOTolerating, SLOFrustrated} {
+		s.counter.WithLabelValues(route.Path, result)
+	}
+}
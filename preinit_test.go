@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPreinitialize(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.SetSLO(SLOConfig{Threshold: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.SetSkipPaths([]string{"/healthz"})
+	prometheus.SetIgnoreStatusCodes([]int{fiber.StatusNotFound})
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	app.Post("/orders", func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	app.Get("/orders/:id", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	app.Get("/healthz", func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	prometheus.Preinitialize(app)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	for _, want := range []string{
+		`http_requests_total{method="GET",path="/",service="test-service",status_code="200"} 0`,
+		`http_requests_total{method="GET",path="/",service="test-service",status_code="500"} 0`,
+		`http_requests_total{method="POST",path="/orders",service="test-service",status_code="400"} 0`,
+		`http_request_duration_seconds_count{method="POST",path="/orders",service="test-service",status_code="200"} 0`,
+		`http_requests_slo_total{result="satisfied",route="/orders/:id",service="test-service"} 0`,
+		`http_requests_slo_total{result="frustrated",route="/",service="test-service"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+	for _, notWant := range []string{
+		`path="/orders/:id"`,
+		`path="/healthz"`,
+		`path="/metrics"`,
+		`status_code="404"`,
+		`route="/healthz"`,
+	} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("Expected no preinitialized series with %s", notWant)
+		}
+	}
+}
+
+func TestPreinitializeStatusCodes(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	prometheus.Preinitialize(app, fiber.StatusOK, fiber.StatusServiceUnavailable)
+
+	// The preinitialized series are the ones requests update.
+	resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	counter := prometheus.RequestsTotal()
+	if got := testutil.ToFloat64(counter.WithLabelValues("200", "GET", "/")); got != 1 {
+		t.Errorf("got %v requests; want 1", got)
+	}
+	if got := testutil.ToFloat64(counter.WithLabelValues("503", "GET", "/")); got != 0 {
+		t.Errorf("got %v requests; want 0", got)
+	}
+	if got := testutil.CollectAndCount(counter); got != 2 {
+		t.Errorf("got %d series; want 2", got)
+	}
+}
@@ -0,0 +1,215 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3/middleware/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// otherUpstream is the upstream label of upstreams beyond
+// UpstreamConfig.MaxUpstreams.
+const otherUpstream = "other"
+
+// UpstreamConfig configures InstrumentProxy.
+type UpstreamConfig struct {
+	// MaxUpstreams bounds the number of distinct upstream label values.
+	// Further upstreams are recorded as "other". Defaults to 50.
+	MaxUpstreams int
+}
+
+// upstreamMetrics holds the reverse proxy collectors. They are registered once
+// per FiberPrometheus and shared by all instrumented balancers.
+type upstreamMetrics struct {
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	errorsTotal     *prometheus.CounterVec
+	selectionsTotal *prometheus.CounterVec
+}
+
+// InstrumentProxy returns a copy of cfg, for use with proxy.Balancer, whose
+// upstream clients record per upstream metrics:
+//
+//   - upstream_requests_total by upstream and status code
+//   - upstream_request_duration_seconds by upstream
+//   - upstream_errors_total by upstream and kind ("timeout" or "error")
+//   - upstream_selections_total by upstream, counting every attempt the
+//     balancer sent to it, retries included
+//
+// The upstream label holds the host of the server, e.g. "10.0.0.1:8080".
+//
+//	cfg, err := prom.InstrumentProxy(proxy.Config{
+//		Servers: []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+//	})
+//	app.Use(proxy.Balancer(cfg))
+func (ps *FiberPrometheus) InstrumentProxy(cfg proxy.Config, opts ...UpstreamConfig) (proxy.Config, error) {
+	var config UpstreamConfig
+	if len(opts) > 0 {
+		config = opts[0]
+	}
+	if config.MaxUpstreams <= 0 {
+		config.MaxUpstreams = 50
+	}
+
+	metrics, err := ps.upstreamCollectors()
+	if err != nil {
+		return cfg, err
+	}
+
+	lbc := &fasthttp.LBClient{Timeout: cfg.Timeout}
+	if cfg.Client != nil {
+		lbc.HealthCheck = cfg.Client.HealthCheck
+		lbc.Timeout = cfg.Client.Timeout
+		lbc.Clients = append(lbc.Clients, cfg.Client.Clients...)
+	} else {
+		if lbc.Timeout <= 0 {
+			lbc.Timeout = proxy.ConfigDefault.Timeout
+		}
+		// Same clients as proxy.Balancer builds for cfg.Servers.
+		for _, server := range cfg.Servers {
+			if !strings.HasPrefix(server, "http") {
+				server = "http://" + server
+			}
+			u, err := url.Parse(server)
+			if err != nil {
+				return cfg, err
+			}
+			lbc.Clients = append(lbc.Clients, &fasthttp.HostClient{
+				NoDefaultUserAgentHeader: true,
+				DisablePathNormalizing:   true,
+				Addr:                     u.Host,
+				ReadBufferSize:           cfg.ReadBufferSize,
+				WriteBufferSize:          cfg.WriteBufferSize,
+				TLSConfig:                cfg.TLSConfig,
+				DialDualStack:            cfg.DialDualStack,
+			})
+		}
+	}
+
+	for i, client := range lbc.Clients {
+		upstream := otherUpstream
+		if i < config.MaxUpstreams {
+			upstream = upstreamName(client, i)
+		}
+		lbc.Clients[i] = &upstreamClient{
+			BalancingClient: client,
+			upstream:        upstream,
+			clock:           ps.clock,
+			metrics:         metrics,
+			duration:        metrics.requestDuration.WithLabelValues(upstream),
+			selections:      metrics.selectionsTotal.WithLabelValues(upstream),
+		}
+	}
+
+	cfg.Client = lbc
+	return cfg, nil
+}
+
+// upstreamName returns the label value of a balancer client.
+func upstreamName(client fasthttp.BalancingClient, index int) string {
+	if hc, ok := client.(*fasthttp.HostClient); ok && hc.Addr != "" {
+		return hc.Addr
+	}
+	return "upstream-" + strconv.Itoa(index)
+}
+
+// upstreamCollectors registers the reverse proxy collectors on first use.
+func (ps *FiberPrometheus) upstreamCollectors() (*upstreamMetrics, error) {
+	if ps.upstreamMetrics != nil {
+		return ps.upstreamMetrics, nil
+	}
+
+	metrics := &upstreamMetrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "upstream_requests_total"),
+			Help:        "Count all proxied http requests by upstream and status code.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("upstream", "status_code")),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "upstream_request_duration_seconds"),
+			Help:        "Duration of all proxied HTTP requests by upstream.",
+			ConstLabels: ps.constLabels,
+			Buckets:     defaultBuckets,
+		}, ps.labelNames("upstream")),
+		errorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "upstream_errors_total"),
+			Help:        "Count all failed proxied http requests by upstream and kind.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("upstream", "kind")),
+		selectionsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "upstream_selections_total"),
+			Help:        "Count all times the balancer selected an upstream.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("upstream")),
+	}
+
+	err := ps.registerVecs(
+		&metrics.requestsTotal,
+		&metrics.requestDuration,
+		&metrics.errorsTotal,
+		&metrics.selectionsTotal,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.upstreamMetrics = metrics
+	return metrics, nil
+}
+
+// upstreamClient wraps a balancer client to record its requests.
+type upstreamClient struct {
+	fasthttp.BalancingClient
+
+	upstream   string
+	clock      Clock
+	metrics    *upstreamMetrics
+	duration   prometheus.Observer
+	selections prometheus.Counter
+}
+
+// DoDeadline implements fasthttp.BalancingClient.
+func (u *upstreamClient) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	u.selections.Inc()
+
+	start := u.clock.Now()
+	err := u.BalancingClient.DoDeadline(req, resp, deadline)
+	u.duration.Observe(u.clock.Since(start).Seconds())
+
+	if err != nil {
+		kind := "error"
+		if errors.Is(err, fasthttp.ErrTimeout) {
+			kind = "timeout"
+		}
+		u.metrics.errorsTotal.WithLabelValues(u.upstream, kind).Inc()
+		return err
+	}
+	u.metrics.requestsTotal.WithLabelValues(u.upstream, strconv.Itoa(resp.StatusCode())).Inc()
+	return nil
+}
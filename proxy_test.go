@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newUpstream(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return u.Host
+}
+
+func sumCounter(t *testing.T, vec *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+	var sum float64
+	for _, label := range labels {
+		sum += testutil.ToFloat64(vec.WithLabelValues(label))
+	}
+	return sum
+}
+
+func TestInstrumentProxy(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	first, second, slow := newUpstream(t, 0), newUpstream(t, 0), newUpstream(t, 200*time.Millisecond)
+
+	balanced, err := fp.InstrumentProxy(proxy.Config{Servers: []string{"http://" + first, second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timingOut, err := fp.InstrumentProxy(proxy.Config{Servers: []string{slow}, Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Get("/balanced", proxy.Balancer(balanced))
+	app.Get("/slow", proxy.Balancer(timingOut))
+
+	for i := 0; i < 4; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/balanced", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusTeapot {
+			t.Errorf("got status %d; want 418", resp.StatusCode)
+		}
+	}
+	resp, err := app.Test(httptest.NewRequest("GET", "/slow", nil), fiber.TestConfig{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("got status %d for the timed out request; want 500", resp.StatusCode)
+	}
+
+	metrics := fp.upstreamMetrics
+	if got := sumCounter(t, metrics.selectionsTotal, first, second); got != 4 {
+		t.Errorf("got %v selections; want 4", got)
+	}
+	requests := testutil.ToFloat64(metrics.requestsTotal.WithLabelValues(first, "418")) +
+		testutil.ToFloat64(metrics.requestsTotal.WithLabelValues(second, "418"))
+	if requests != 4 {
+		t.Errorf("got %v requests; want 4", requests)
+	}
+	if got := testutil.ToFloat64(metrics.errorsTotal.WithLabelValues(slow, "timeout")); got < 1 {
+		t.Errorf("got %v timeouts; want at least 1", got)
+	}
+	if got := testutil.CollectAndCount(metrics.requestDuration); got != 3 {
+		t.Errorf("got %d duration series; want 3", got)
+	}
+}
+
+func TestInstrumentProxyMaxUpstreams(t *testing.T) {
+	t.Parallel()
+
+	fp := New("test-service")
+	cfg, err := fp.InstrumentProxy(proxy.Config{
+		Servers: []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"},
+	}, UpstreamConfig{MaxUpstreams: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, client := range cfg.Client.Clients {
+		got = append(got, client.(*upstreamClient).upstream)
+	}
+	want := []string{"10.0.0.1:80", "10.0.0.2:80", otherUpstream}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got upstreams %v; want %v", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultQueueTimeHeader is the header most load balancers use to stamp the
+// time a request was accepted.
+const DefaultQueueTimeHeader = "X-Request-Start"
+
+// maxQueueDuration bounds the queue time we are willing to record. Anything
+// larger almost certainly comes from clock skew or a bogus header.
+const maxQueueDuration = time.Hour
+
+// SetQueueTimeHeader enables the request_queue_duration_seconds histogram,
+// computed from the given request header against the local clock.
+// An empty header falls back to DefaultQueueTimeHeader.
+//
+// The header may hold seconds, milliseconds, microseconds or nanoseconds
+// since the epoch, optionally prefixed with "t=", e.g.
+// `t=1700000000123456` (Apache), `t=1700000000.123` (nginx) or
+// `1700000000123` (Heroku).
+func (ps *FiberPrometheus) SetQueueTimeHeader(header string) error {
+	if header == "" {
+		header = DefaultQueueTimeHeader
+	}
+	if ps.queueDuration == nil {
+		histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "request_queue_duration_seconds"),
+			Help:        "Time requests spent queued upstream before reaching fiber, by method.",
+			ConstLabels: ps.constLabels,
+			Buckets:     defaultBuckets,
+		}, ps.labelNames("method"))
+		if err := ps.registerVecs(&histogram); err != nil {
+			return err
+		}
+		ps.queueDuration = histogram
+	}
+	ps.queueHeaderKey = header
+	return nil
+}
+
+// observeQueueTime records the time between the upstream request start
+// header and now. Negative values, caused by clocks running slightly apart,
+// are clamped to zero.
+func (ps *FiberPrometheus) observeQueueTime(header, method string, now time.Time) {
+	start, ok := parseRequestStart(header)
+	if !ok {
+		return
+	}
+	queued := now.Sub(start)
+	if queued < 0 {
+		queued = 0
+	}
+	if queued > maxQueueDuration {
+		return
+	}
+	ps.queueDuration.WithLabelValues(method).Observe(queued.Seconds())
+}
+
+// parseRequestStart parses the common X-Request-Start formats. The unit of
+// integer values is inferred from their magnitude.
+func parseRequestStart(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "t=")
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if strings.IndexByte(value, '.') >= 0 {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(seconds*1e9)), true
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case n >= 1e18: // nanoseconds
+		return time.Unix(0, n), true
+	case n >= 1e15: // microseconds
+		return time.UnixMicro(n), true
+	case n >= 1e12: // milliseconds
+		return time.UnixMilli(n), true
+	default: // seconds
+		return time.Unix(n, 0), true
+	}
+}
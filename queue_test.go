@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestParseRequestStart(t *testing.T) {
+	t.Parallel()
+
+	want := time.Date(2023, 11, 14, 22, 13, 20, 123000000, time.UTC)
+	cases := map[string]string{
+		"microseconds":    "t=1700000000123000",
+		"milliseconds":    "1700000000123",
+		"nanoseconds":     "t=1700000000123000000",
+		"fractional":      "t=1700000000.123",
+		"with whitespace": " t=1700000000123 ",
+	}
+	for name, header := range cases {
+		got, ok := parseRequestStart(header)
+		if !ok {
+			t.Errorf("%s: failed to parse %q", name, header)
+			continue
+		}
+		if d := got.Sub(want); d > time.Millisecond || d < -time.Millisecond {
+			t.Errorf("%s: got %s; want %s", name, got, want)
+		}
+	}
+
+	got, ok := parseRequestStart("1700000000")
+	if !ok || !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("seconds: got %s", got)
+	}
+
+	for _, header := range []string{"", "t=", "garbage", "t=-5", "0"} {
+		if _, ok := parseRequestStart(header); ok {
+			t.Errorf("expected %q to be rejected", header)
+		}
+	}
+}
+
+func TestQueueTime(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.SetQueueTimeHeader(""); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	headers := []string{
+		// queued upstream for a second
+		"t=" + strconv.FormatInt(time.Now().Add(-time.Second).UnixMicro(), 10),
+		// proxy clock ahead of ours, clamped to zero
+		strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10),
+		// skewed by more than an hour, dropped
+		strconv.FormatInt(time.Now().Add(-2*time.Hour).UnixMilli(), 10),
+		// unparsable, dropped
+		"yesterday",
+	}
+	for _, header := range headers {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(DefaultQueueTimeHeader, header)
+		resp, _ := app.Test(req)
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	want := `http_request_queue_duration_seconds_count{method="GET",service="test-service"} 2`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_request_queue_duration_seconds_bucket{method="GET",service="test-service",le="1e-09"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_request_queue_duration_seconds_bucket{method="GET",service="test-service",le="0.5"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// unmatchedRoute is used as route label for requests no route handled. It can
+// not collide with a real route template since those always start with '/'.
+const unmatchedRoute = "unmatched"
+
+// routeTemplate returns the template of the route that handled the request,
+// e.g. "/users/:id". It must be called after ctx.Next() returned.
+func routeTemplate(ctx fiber.Ctx) string {
+	if !ctx.Matched() {
+		return unmatchedRoute
+	}
+	return ctx.Route().Path
+}
+
+// routeTable is a snapshot of the routes registered on an app, used to find
+// the route template of a request before the router dispatched it.
+type routeTable struct {
+	config fiber.Config
+	static map[string]map[string]string // method -> path -> template
+	routes map[string][]string          // method -> templates, in registration order
+}
+
+func newRouteTable(app *fiber.App) *routeTable {
+	t := &routeTable{
+		config: app.Config(),
+		static: make(map[string]map[string]string),
+		routes: make(map[string][]string),
+	}
+	for _, route := range app.GetRoutes(true) {
+		t.routes[route.Method] = append(t.routes[route.Method], route.Path)
+		if !isStaticRoute(route) {
+			continue
+		}
+		if t.static[route.Method] == nil {
+			t.static[route.Method] = make(map[string]string)
+		}
+		key := t.normalize(route.Path)
+		if _, ok := t.static[route.Method][key]; !ok {
+			t.static[route.Method][key] = route.Path
+		}
+	}
+	return t
+}
+
+// isStaticRoute reports whether route matches a single path, without
+// parameters or wildcards.
+func isStaticRoute(route fiber.Route) bool {
+	return len(route.Params) == 0 && !strings.ContainsAny(route.Path, "*+?")
+}
+
+// normalize applies the app's case sensitivity and strict routing settings
+// the same way the fiber router does.
+func (t *routeTable) normalize(path string) string {
+	if !t.config.CaseSensitive {
+		path = strings.ToLower(path)
+	}
+	if !t.config.StrictRouting && len(path) > 1 {
+		if path = strings.TrimRight(path, "/"); path == "" {
+			path = "/"
+		}
+	}
+	return path
+}
+
+func (t *routeTable) lookup(method, path string) string {
+	path = t.normalize(path)
+	if template, ok := t.static[method][path]; ok {
+		return template
+	}
+	for _, template := range t.routes[method] {
+		if fiber.RoutePatternMatch(path, template, t.config) {
+			return template
+		}
+	}
+	return unmatchedRoute
+}
+
+// lookupRoute returns the route template a request will be dispatched to.
+// Unlike routeTemplate it can be called before ctx.Next(). The routes of an
+// app are snapshotted on its first request, so they are expected to be
+// registered before serving.
+func (ps *FiberPrometheus) lookupRoute(ctx fiber.Ctx) string {
+	if ctx.Matched() {
+		return ctx.Route().Path
+	}
+	app := ctx.App()
+	table, ok := ps.routeTables.Load(app)
+	if !ok {
+		table, _ = ps.routeTables.LoadOrStore(app, newRouteTable(app))
+	}
+	return table.(*routeTable).lookup(ctx.Method(), ctx.Path())
+}
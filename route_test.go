@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestRouteTableLookup(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	handler := func(c fiber.Ctx) error { return nil }
+	app.Use(handler)
+	app.Get("/users", handler)
+	app.Get("/users/:id", handler)
+	app.Post("/files/*", handler)
+
+	table := newRouteTable(app)
+	cases := []struct {
+		method, path, want string
+	}{
+		{"GET", "/users", "/users"},
+		{"GET", "/Users/", "/users"},
+		{"GET", "/users/42", "/users/:id"},
+		{"POST", "/files/a/b.txt", "/files/*"},
+		{"GET", "/files/a/b.txt", unmatchedRoute},
+		{"DELETE", "/users", unmatchedRoute},
+	}
+	for _, tc := range cases {
+		if got := table.lookup(tc.method, tc.path); got != tc.want {
+			t.Errorf("lookup(%s, %s) = %s; want %s", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
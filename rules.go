@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RulesConfig configures WriteRules.
+type RulesConfig struct {
+	// Objective is the availability target the error budget is derived
+	// from. Defaults to 0.999.
+	Objective float64
+
+	// Window is the rate window of the recorded request, error and latency
+	// series. Defaults to "5m".
+	Window string
+}
+
+// burnRateAlert is a multi-window burn rate alert as described in the Google
+// SRE workbook: it fires when both windows burn the budget Factor times
+// faster than allowed.
+type burnRateAlert struct {
+	Long, Short string
+	Factor      float64
+	Severity    string
+}
+
+var burnRateAlerts = []burnRateAlert{
+	{Long: "1h", Short: "5m", Factor: 14.4, Severity: "page"},
+	{Long: "6h", Short: "30m", Factor: 6, Severity: "page"},
+	{Long: "1d", Short: "2h", Factor: 3, Severity: "ticket"},
+	{Long: "3d", Short: "6h", Factor: 1, Severity: "ticket"},
+}
+
+// WriteRules writes a Prometheus rules file with recording rules for the
+// request rate, error ratio and p95/p99 latency, and multi-window burn rate
+// alerts for the error budget. When SetSLO was called, the share of
+// frustrated requests gets burn rate alerts as well.
+//
+// Metric names and the label selector match the instance's namespace,
+// subsystem and const labels.
+func (ps *FiberPrometheus) WriteRules(w io.Writer, cfg RulesConfig) error {
+	if cfg.Objective <= 0 || cfg.Objective >= 1 {
+		cfg.Objective = 0.999
+	}
+	if cfg.Window == "" {
+		cfg.Window = "5m"
+	}
+
+	windows := map[string]bool{cfg.Window: true}
+	for _, alert := range burnRateAlerts {
+		windows[alert.Long] = true
+		windows[alert.Short] = true
+	}
+	sortedWindows := make([]string, 0, len(windows))
+	for window := range windows {
+		sortedWindows = append(sortedWindows, window)
+	}
+	sort.Slice(sortedWindows, func(i, j int) bool {
+		return windowSeconds(sortedWindows[i]) < windowSeconds(sortedWindows[j])
+	})
+
+	prefix := ps.rulePrefix()
+	data := map[string]any{
+		"Group":       prefix,
+		"Prefix":      prefix,
+		"AlertPrefix": alertPrefix(prefix),
+		"Window":      cfg.Window,
+		"Windows":     sortedWindows,
+		"Alerts":      burnRateAlerts,
+		"Quantiles": []struct{ Name, Value string }{
+			{Name: "p95", Value: "0.95"},
+			{Name: "p99", Value: "0.99"},
+		},
+		"Budget":          strconv.FormatFloat(1-cfg.Objective, 'g', 6, 64),
+		"Objective":       strconv.FormatFloat(cfg.Objective*100, 'g', 6, 64),
+		"RequestsTotal":   ps.metricName("requests_total"),
+		"DurationBuckets": ps.metricName("request_duration_seconds") + "_bucket",
+		"SLOTotal":        ps.metricName("requests_slo_total"),
+		"SLO":             ps.slo != nil,
+		"By":              ps.groupBy(),
+		"ByPath":          ps.groupBy("method", "path"),
+		"ByLePath":        ps.groupBy("le", "method", "path"),
+		"Selector":        ps.labelSelector(),
+		"ErrorSelector":   ps.labelSelector(`status_code=~"5.."`),
+		"FrustratedSel":   ps.labelSelector(`result="frustrated"`),
+	}
+	return rulesTemplate.Execute(w, data)
+}
+
+// metricName returns the fully-qualified name of one of the instance's
+// metrics, exactly as built by create.
+func (ps *FiberPrometheus) metricName(name string) string {
+	return prometheus.BuildFQName(ps.namespace, ps.subsystem, name)
+}
+
+// groupBy returns the const label names followed by extra labels, for use in
+// a PromQL `by` clause. Keeping the const labels apart lets several services
+// share the recorded series.
+func (ps *FiberPrometheus) groupBy(extra ...string) string {
+	return strings.Join(append(ps.constLabelNames(), extra...), ", ")
+}
+
+// labelSelector returns a PromQL label selector for the instance's const
+// labels, with extra matchers appended.
+func (ps *FiberPrometheus) labelSelector(extra ...string) string {
+	names := ps.constLabelNames()
+	matchers := make([]string, 0, len(names)+len(extra))
+	for _, name := range names {
+		matchers = append(matchers, name+"="+strconv.Quote(ps.constLabels[name]))
+	}
+	for _, matcher := range extra {
+		if matcher != "" {
+			matchers = append(matchers, matcher)
+		}
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// rulePrefix is the level of the recorded series, following the
+// level:metric:operations naming convention.
+func (ps *FiberPrometheus) rulePrefix() string {
+	parts := make([]string, 0, 2)
+	for _, part := range []string{ps.namespace, ps.subsystem} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "fiber"
+	}
+	return strings.Join(parts, "_")
+}
+
+// alertPrefix turns a rule prefix like "my_app_http" into "MyAppHttp".
+func alertPrefix(prefix string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(prefix, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]))
+		b.WriteString(part[1:])
+	}
+	return b.String()
+}
+
+// windowSeconds converts a Prometheus duration like "30m" or "3d" to seconds.
+func windowSeconds(window string) int {
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	if len(window) < 2 {
+		return 0
+	}
+	n, err := strconv.Atoi(window[:len(window)-1])
+	if err != nil {
+		return 0
+	}
+	return n * units[window[len(window)-1]]
+}
+
+var rulesTemplate = template.Must(template.New("rules").Funcs(template.FuncMap{
+	"factor":  func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) },
+	"quote":   strconv.Quote,
+	"sprintf": fmt.Sprintf,
+}).Parse(`# Generated by fiberprometheus, do not edit.
+groups:
+  - name: {{ .Group }}.rules
+    rules:
+      - record: {{ .Prefix }}:requests:rate{{ .Window }}
+        expr: |
+          sum by ({{ .ByPath }}) (rate({{ .RequestsTotal }}{{ .Selector }}[{{ .Window }}]))
+{{- range .Windows }}
+      - record: {{ $.Prefix }}:errors:ratio_rate{{ . }}
+        expr: |
+          sum by ({{ $.By }}) (rate({{ $.RequestsTotal }}{{ $.ErrorSelector }}[{{ . }}]))
+          /
+          sum by ({{ $.By }}) (rate({{ $.RequestsTotal }}{{ $.Selector }}[{{ . }}]))
+{{- end }}
+{{- range .Quantiles }}
+      - record: {{ $.Prefix }}:request_duration_seconds:{{ .Name }}_rate{{ $.Window }}
+        expr: |
+          histogram_quantile({{ .Value }}, sum by ({{ $.ByLePath }}) (rate({{ $.DurationBuckets }}{{ $.Selector }}[{{ $.Window }}])))
+{{- end }}
+{{- if .SLO }}
+{{- range .Windows }}
+      - record: {{ $.Prefix }}:slo_frustrated:ratio_rate{{ . }}
+        expr: |
+          sum by ({{ $.By }}) (rate({{ $.SLOTotal }}{{ $.FrustratedSel }}[{{ . }}]))
+          /
+          sum by ({{ $.By }}) (rate({{ $.SLOTotal }}{{ $.Selector }}[{{ . }}]))
+{{- end }}
+{{- end }}
+  - name: {{ .Group }}.alerts
+    rules:
+{{- range .Alerts }}
+      - alert: {{ $.AlertPrefix }}ErrorBudgetBurn
+        expr: |
+          {{ $.Prefix }}:errors:ratio_rate{{ .Long }} > ({{ factor .Factor }} * {{ $.Budget }})
+          and
+          {{ $.Prefix }}:errors:ratio_rate{{ .Short }} > ({{ factor .Factor }} * {{ $.Budget }})
+        labels:
+          severity: {{ .Severity }}
+          long_window: {{ .Long }}
+        annotations:
+          summary: {{ quote (sprintf "Error budget of the %s%% availability objective is burning %sx too fast over %s" $.Objective (factor .Factor) .Long) }}
+{{- end }}
+{{- if .SLO }}
+{{- range .Alerts }}
+      - alert: {{ $.AlertPrefix }}LatencyBudgetBurn
+        expr: |
+          {{ $.Prefix }}:slo_frustrated:ratio_rate{{ .Long }} > ({{ factor .Factor }} * {{ $.Budget }})
+          and
+          {{ $.Prefix }}:slo_frustrated:ratio_rate{{ .Short }} > ({{ factor .Factor }} * {{ $.Budget }})
+        labels:
+          severity: {{ .Severity }}
+          long_window: {{ .Long }}
+        annotations:
+          summary: {{ quote (sprintf "Latency budget of the %s%% objective is burning %sx too fast over %s" $.Objective (factor .Factor) .Long) }}
+{{- end }}
+{{- end }}
+`))
@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteRules(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	fp := NewWithRegistry(registry, "unique-service", "my_app", "http", map[string]string{"team": "core"})
+
+	var buf bytes.Buffer
+	if err := fp.WriteRules(&buf, RulesConfig{Objective: 0.99}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`- name: my_app_http.rules`,
+		`- record: my_app_http:requests:rate5m`,
+		`sum by (service, team, method, path) (rate(my_app_http_requests_total{service="unique-service",team="core"}[5m]))`,
+		`sum by (service, team) (rate(my_app_http_requests_total{service="unique-service",team="core",status_code=~"5.."}[1h]))`,
+		`- record: my_app_http:request_duration_seconds:p99_rate5m`,
+		`histogram_quantile(0.99, sum by (service, team, le, method, path) (rate(my_app_http_request_duration_seconds_bucket{service="unique-service",team="core"}[5m])))`,
+		`- alert: MyAppHttpErrorBudgetBurn`,
+		`my_app_http:errors:ratio_rate1h > (14.4 * 0.01)`,
+		`my_app_http:errors:ratio_rate3d > (1 * 0.01)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+
+	// The metric names match what is actually registered.
+	fp.requestsTotal.WithLabelValues("200", "GET", "/").Inc()
+	fp.requestDuration.WithLabelValues("200", "GET", "/").Observe(1)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		name := family.GetName()
+		if family.GetType().String() == "HISTOGRAM" {
+			name += "_bucket"
+		}
+		if strings.Contains(name, "requests_total") || strings.Contains(name, "request_duration") {
+			if !strings.Contains(got, name+"{") {
+				t.Errorf("rules do not reference %s", name)
+			}
+		}
+	}
+
+	notWant := "LatencyBudgetBurn"
+	if strings.Contains(got, notWant) {
+		t.Errorf("Expected no latency alerts without SLO, but found: %s", notWant)
+	}
+}
+
+func TestWriteRulesWithSLO(t *testing.T) {
+	t.Parallel()
+
+	fp := New("test-service")
+	if err := fp.SetSLO(SLOConfig{Threshold: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := fp.WriteRules(&buf, RulesConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`- record: http:slo_frustrated:ratio_rate6h`,
+		`sum by (service) (rate(http_requests_slo_total{service="test-service",result="frustrated"}[6h]))`,
+		`- alert: HttpLatencyBudgetBurn`,
+		`http:slo_frustrated:ratio_rate1h > (14.4 * 0.001)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesCache holds the label values of the requests seen so far, so the
+// middleware resolves its series with a couple of map lookups and without
+// allocating once a path, method and status code were seen. The series are
+// looked up in their vectors on every request, never kept, so resetting the
+// vectors or deleting series from them is safe.
+type seriesCache struct {
+	paths    sync.Map // pathKey -> *pathSeries
+	inFlight sync.Map // method -> prometheus.Gauge
+}
+
+// pathKey identifies the requests of one method to one path.
+type pathKey struct {
+	method string
+	path   string
+}
+
+// pathSeries caches the label values of one method and path, by status code.
+type pathSeries struct {
+	// path is a copy of the request path, safe to keep after the request.
+	path   string
+	status sync.Map // int -> *statusSeries
+	// route is the template of the route that handled the first recorded
+	// request, used to group paths in RouteSummaries.
+	route atomic.Pointer[string]
+
+	// mu is read-locked by requests updating the series while expiry is
+	// enabled, and locked while expired series are deleted.
+	mu      sync.RWMutex
+	expired bool
+}
+
+// statusSeries caches the label values of one method, path and status code.
+type statusSeries struct {
+	statusCode string
+	// lastSeen is the time of the last update in Unix nanoseconds, kept
+	// while expiry is enabled.
+	lastSeen atomic.Int64
+	// pinned series were preinitialized and never expire.
+	pinned atomic.Bool
+}
+
+// loadPathSeries returns the cached series of method and path, or nil when
+// no request to them was recorded yet.
+func (ps *FiberPrometheus) loadPathSeries(method, path string) *pathSeries {
+	if v, ok := ps.series.paths.Load(pathKey{method: method, path: path}); ok {
+		return v.(*pathSeries)
+	}
+	return nil
+}
+
+// pathSeries returns the cached series of method and path, creating them
+// on first use. The path is kept, it must not point into request buffers.
+func (ps *FiberPrometheus) pathSeries(method, path string) *pathSeries {
+	if p := ps.loadPathSeries(method, path); p != nil {
+		return p
+	}
+	v, _ := ps.series.paths.LoadOrStore(pathKey{method: method, path: path}, &pathSeries{path: path})
+	return v.(*pathSeries)
+}
+
+// setRoute records the route template of p on its first request.
+func (p *pathSeries) setRoute(ctx fiber.Ctx) {
+	if p.route.Load() == nil {
+		route := routeTemplate(ctx)
+		p.route.Store(&route)
+	}
+}
+
+// seriesRoute returns the route template of the requests of method to path,
+// a path label value. Paths not recorded by the middleware, e.g. those of
+// preinitialized or expired series, fall back to the path without its query.
+func (ps *FiberPrometheus) seriesRoute(method, path string) string {
+	if v, ok := ps.series.paths.Load(pathKey{method: method, path: path}); ok {
+		if route := v.(*pathSeries).route.Load(); route != nil {
+			return *route
+		}
+	}
+	route, _, _ := strings.Cut(path, "?")
+	return route
+}
+
+// statusSeries returns the cached series of a status code of p.
+func (ps *FiberPrometheus) statusSeries(p *pathSeries, status int) *statusSeries {
+	if v, ok := p.status.Load(status); ok {
+		return v.(*statusSeries)
+	}
+	s := &statusSeries{statusCode: strconv.Itoa(status)}
+	if ps.expiry != nil {
+		s.lastSeen.Store(ps.clock.Now().UnixNano())
+	}
+	v, _ := p.status.LoadOrStore(status, s)
+	return v.(*statusSeries)
+}
+
+// inFlightGauge returns the cached requests_in_progress_total gauge of method.
+func (ps *FiberPrometheus) inFlightGauge(method string) prometheus.Gauge {
+	if v, ok := ps.series.inFlight.Load(method); ok {
+		return v.(prometheus.Gauge)
+	}
+	v, _ := ps.series.inFlight.LoadOrStore(method, ps.requestInFlight.WithLabelValues(method))
+	return v.(prometheus.Gauge)
+}
+
+// reset drops all cached series.
+func (c *seriesCache) reset() {
+	c.paths.Clear()
+	c.inFlight.Clear()
+}
+
+// unsafeString returns a string sharing the memory of b. It must not be kept
+// after b is modified.
+func unsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
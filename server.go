@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/healthcheck"
+	"github.com/gofiber/fiber/v3/middleware/pprof"
+)
+
+// defaultShutdownTimeout bounds the graceful shutdown of a metrics server.
+const defaultShutdownTimeout = 5 * time.Second
+
+// MetricsServerConfig configures the listener started by ServeMetrics.
+type MetricsServerConfig struct {
+	// Path of the metrics endpoint. Defaults to "/metrics".
+	Path string
+
+	// HealthPath serves a liveness probe answering 200 OK, e.g. "/livez".
+	// Disabled when empty.
+	HealthPath string
+
+	// Pprof serves the net/http/pprof handlers under /debug/pprof.
+	Pprof bool
+
+	// TLSConfig serves the endpoints over TLS. Set ClientAuth and ClientCAs
+	// to require client certificates, see MetricsAuthConfig.ClientCertSubjects.
+	TLSConfig *tls.Config
+
+	// App is the main application. The metrics server shuts down after it,
+	// so scrapes keep working while the main app drains its connections.
+	App *fiber.App
+
+	// ShutdownTimeout bounds the graceful shutdown, after which open
+	// connections are closed. Defaults to 5 seconds.
+	ShutdownTimeout time.Duration
+}
+
+// MetricsServer is a listener serving the metrics apart from the main app.
+type MetricsServer struct {
+	app      *fiber.App
+	listener net.Listener
+	timeout  time.Duration
+	done     chan struct{}
+	once     sync.Once
+}
+
+// ServeMetrics starts a separate listener on addr serving the metrics of the
+// instance's gatherer, so they are not exposed on the public port. It returns
+// once the listener is bound; use ":0" to pick a free port and Addr to read it.
+//
+// The server is shut down with MetricsServerConfig.App, by Close, or by
+// MetricsServer.Shutdown.
+func (ps *FiberPrometheus) ServeMetrics(addr string, cfg ...MetricsServerConfig) (*MetricsServer, error) {
+	var config MetricsServerConfig
+	if len(cfg) > 0 {
+		config = cfg[0]
+	}
+	if config.Path == "" {
+		config.Path = "/metrics"
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	app := fiber.New()
+	app.Get(config.Path, ps.metricsHandler())
+	if config.HealthPath != "" {
+		app.Get(config.HealthPath, healthcheck.New())
+	}
+	if config.Pprof {
+		app.Use("/debug/pprof", ps.requireMetricsAuth)
+		app.Use(pprof.New())
+	}
+
+	ln, err := net.Listen(fiber.NetworkTCP, addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.TLSConfig != nil {
+		ln = tls.NewListener(ln, config.TLSConfig)
+	}
+	s := &MetricsServer{
+		app:      app,
+		listener: ln,
+		timeout:  config.ShutdownTimeout,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		_ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	}()
+
+	if config.App != nil {
+		config.App.Hooks().OnPostShutdown(func(error) error {
+			return s.close()
+		})
+	}
+	ps.servers = append(ps.servers, s)
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *MetricsServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Shutdown gracefully stops the server, waiting for open requests until ctx
+// is done. It is idempotent.
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	var err error
+	s.once.Do(func() {
+		err = s.app.ShutdownWithContext(ctx)
+		if errors.Is(err, fiber.ErrNotRunning) {
+			err = nil
+		}
+		// The listener may not be served yet, closing it stops Listener anyway.
+		if closeErr := s.listener.Close(); err == nil && closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+			err = closeErr
+		}
+		<-s.done
+	})
+	return err
+}
+
+// close shuts the server down within its shutdown timeout.
+func (s *MetricsServer) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
@@ -0,0 +1,171 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServeMetrics(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+	fp := NewWithRegistry(registry, "test-service", "http", "", nil)
+
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	server, err := fp.ServeMetrics("127.0.0.1:0", MetricsServerConfig{
+		HealthPath: "/livez",
+		Pprof:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fp.Close() })
+	base := "http://" + server.Addr().String()
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	status, body := get(t, base+"/metrics")
+	want := `http_requests_total{method="GET",path="/",service="test-service",status_code="200"} 1`
+	if status != 200 || !strings.Contains(body, want) {
+		t.Errorf("got %d %s; want %s", status, body, want)
+	}
+	if status, _ := get(t, base+"/livez"); status != 200 {
+		t.Errorf("got status %d from /livez; want 200", status)
+	}
+	if status, _ := get(t, base+"/debug/pprof/"); status != 200 {
+		t.Errorf("got status %d from /debug/pprof/; want 200", status)
+	}
+
+	// The metrics endpoint is not mounted on the main app.
+	resp, _ = app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if resp.StatusCode != 404 {
+		t.Errorf("got status %d from the main app; want 404", resp.StatusCode)
+	}
+}
+
+func TestServeMetricsDefaults(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+
+	server, err := fp.ServeMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + server.Addr().String()
+	for _, path := range []string{"/livez", "/debug/pprof/"} {
+		if status, _ := get(t, base+path); status != 404 {
+			t.Errorf("got status %d from %s; want 404", status, path)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("got %v from a second Shutdown; want nil", err)
+	}
+	if _, err := http.Get(base + "/metrics"); err == nil {
+		t.Error("got a response after Shutdown")
+	}
+	if err := fp.Close(); err != nil {
+		t.Errorf("got %v from Close; want nil", err)
+	}
+}
+
+func TestServeMetricsShutdownWithApp(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+
+	app := fiber.New()
+	server, err := fp.ServeMetrics("127.0.0.1:0", MetricsServerConfig{App: app})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen(fiber.NetworkTCP, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listening := make(chan struct{})
+	app.Hooks().OnListen(func(fiber.ListenData) error {
+		close(listening)
+		return nil
+	})
+	go app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	<-listening
+
+	base := "http://" + server.Addr().String()
+	if status, _ := get(t, base+"/metrics"); status != 200 {
+		t.Fatalf("got status %d; want 200", status)
+	}
+	if err := app.ShutdownWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(base + "/metrics"); err == nil {
+		t.Error("got a response after the main app shut down")
+	}
+}
+
+func TestServeMetricsAddressInUse(t *testing.T) {
+	t.Parallel()
+	fp := NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+
+	server, err := fp.ServeMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fp.Close() })
+	if _, err := fp.ServeMetrics(server.Addr().String()); err == nil {
+		t.Error("got no error for an address in use")
+	}
+}
@@ -0,0 +1,178 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// appLabel is the variable label telling apart the instances sharing
+// collectors, see Config.App.
+const appLabel = "app"
+
+// App returns the app label value of this instance, empty unless it shares
+// its collectors.
+func (ps *FiberPrometheus) App() string {
+	return ps.app
+}
+
+// labelNames returns the variable label names of a vector, prefixed with the
+// app label in shared mode.
+func (ps *FiberPrometheus) labelNames(names ...string) []string {
+	if ps.app == "" {
+		return names
+	}
+	return append([]string{appLabel}, names...)
+}
+
+// instanceLabels returns the const labels of collectors that are not shared
+// between instances, which carry the app label as a const label instead.
+func (ps *FiberPrometheus) instanceLabels() prometheus.Labels {
+	if ps.app == "" {
+		return ps.constLabels
+	}
+	labels := make(prometheus.Labels, len(ps.constLabels)+1)
+	for name, value := range ps.constLabels {
+		labels[name] = value
+	}
+	labels[appLabel] = ps.app
+	return labels
+}
+
+// registerVecs registers the metric vectors pointed to by vecs, each a
+// **prometheus.CounterVec, **prometheus.HistogramVec or
+// **prometheus.GaugeVec. In shared mode, a vector already registered by
+// another instance is reused, and the pointers are set to the vectors
+// curried with this instance's app label. On failure the vectors registered
+// so far are unregistered again.
+func (ps *FiberPrometheus) registerVecs(vecs ...any) error {
+	for i, v := range vecs {
+		if err := ps.registerVec(v); err != nil {
+			ps.unregisterVecs(vecs[:i]...)
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *FiberPrometheus) registerVec(v any) error {
+	curry := prometheus.Labels{appLabel: ps.app}
+	switch v := v.(type) {
+	case **prometheus.CounterVec:
+		base, err := registerShared(ps, *v)
+		if err != nil || ps.app == "" {
+			return err
+		}
+		if *v, err = base.CurryWith(curry); err != nil {
+			return err
+		}
+		ps.shared[(*v).MetricVec] = base.MetricVec
+	case **prometheus.HistogramVec:
+		base, err := registerShared(ps, *v)
+		if err != nil || ps.app == "" {
+			return err
+		}
+		curried, err := base.CurryWith(curry)
+		if err != nil {
+			return err
+		}
+		*v = curried.(*prometheus.HistogramVec)
+		ps.shared[(*v).MetricVec] = base.MetricVec
+	case **prometheus.GaugeVec:
+		base, err := registerShared(ps, *v)
+		if err != nil || ps.app == "" {
+			return err
+		}
+		if *v, err = base.CurryWith(curry); err != nil {
+			return err
+		}
+		ps.shared[(*v).MetricVec] = base.MetricVec
+	default:
+		panic(fmt.Sprintf("fiberprometheus: can not register %T", v))
+	}
+	return nil
+}
+
+// registerShared registers c, or in shared mode returns the collector of the
+// same type already registered in its place.
+func registerShared[C prometheus.Collector](ps *FiberPrometheus, c C) (C, error) {
+	if ps.app == "" {
+		return c, ps.register(c)
+	}
+	err := ps.registerer.Register(c)
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		if existing, ok := already.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// unregisterVecs unregisters vectors registered by registerVecs. Shared
+// vectors stay registered, other instances may still use them.
+func (ps *FiberPrometheus) unregisterVecs(vecs ...any) {
+	for _, v := range vecs {
+		var c prometheus.Collector
+		switch v := v.(type) {
+		case **prometheus.CounterVec:
+			c = *v
+		case **prometheus.HistogramVec:
+			c = *v
+		case **prometheus.GaugeVec:
+			c = *v
+		}
+		ps.unregister(c)
+	}
+}
+
+// unregister removes a collector registered with register.
+func (ps *FiberPrometheus) unregister(c prometheus.Collector) {
+	i := slices.Index(ps.collectors, c)
+	if i < 0 {
+		return
+	}
+	ps.collectors = slices.Delete(ps.collectors, i, i+1)
+	ps.registerer.Unregister(c)
+}
+
+// deleteAppSeries deletes the series of this instance from the shared vectors.
+func (ps *FiberPrometheus) deleteAppSeries() {
+	for _, base := range ps.shared {
+		base.DeletePartialMatch(prometheus.Labels{appLabel: ps.app})
+	}
+}
+
+// deletePartialMatch deletes the series of vec matching labels. Partial
+// matches ignore curried labels, so for shared vectors the match is made on
+// the base vector, restricted to this instance's app.
+func (ps *FiberPrometheus) deletePartialMatch(vec *prometheus.MetricVec, labels prometheus.Labels) {
+	if base, ok := ps.shared[vec]; ok {
+		labels[appLabel] = ps.app
+		vec = base
+	}
+	vec.DeletePartialMatch(labels)
+}
@@ -0,0 +1,188 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/fiberprometheustest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSharedCollectors(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+
+	var apps []*fiber.App
+	var fps []*fiberprometheus.FiberPrometheus
+	for _, name := range []string{"public", "admin"} {
+		fp, err := fiberprometheus.NewWithConfig(fiberprometheus.Config{
+			Registerer:  registry,
+			ServiceName: "test-service",
+			Namespace:   "http",
+			App:         name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fp.SetSLO(fiberprometheus.SLOConfig{Threshold: time.Second}); err != nil {
+			t.Fatal(err)
+		}
+		if err := fp.EnableInFlightByRoute(); err != nil {
+			t.Fatal(err)
+		}
+
+		app := fiber.New()
+		fp.RegisterAt(app, "/metrics")
+		app.Use(fp.Middleware)
+		app.Get("/", func(c fiber.Ctx) error {
+			return c.SendString("Hello World")
+		})
+		apps, fps = append(apps, app), append(fps, fp)
+	}
+	public, admin := apps[0], apps[1]
+	publicFP, adminFP := fps[0], fps[1]
+
+	for _, app := range []*fiber.App{public, admin, admin} {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	// Either app serves the metrics of both.
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := public.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	for _, want := range []string{
+		`http_requests_total{app="public",method="GET",path="/",service="test-service",status_code="200"} 1`,
+		`http_requests_total{app="admin",method="GET",path="/",service="test-service",status_code="200"} 2`,
+		`http_requests_slo_total{app="admin",result="satisfied",route="/",service="test-service"} 2`,
+		`http_requests_in_progress_by_route{app="public",method="GET",route="/",service="test-service"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+
+	// Resetting or unregistering one app leaves the other untouched.
+	adminFP.Reset()
+	if got := testutil.ToFloat64(publicFP.RequestsTotal().WithLabelValues("200", "GET", "/")); got != 1 {
+		t.Errorf("got %v public requests after the admin reset; want 1", got)
+	}
+	publicFP.Unregister()
+	resp, _ = admin.Test(httptest.NewRequest("GET", "/", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if got := testutil.ToFloat64(adminFP.RequestsTotal().WithLabelValues("200", "GET", "/")); got != 1 {
+		t.Errorf("got %v admin requests; want 1", got)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "app" && label.GetValue() == "public" {
+					t.Errorf("%s: found a series of the unregistered public app", family.GetName())
+				}
+			}
+		}
+	}
+}
+
+func TestSharedSeriesExpiry(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+
+	var fps []*fiberprometheus.FiberPrometheus
+	for _, name := range []string{"public", "admin"} {
+		fp, err := fiberprometheus.NewWithConfig(fiberprometheus.Config{
+			Registerer:  registry,
+			ServiceName: "test-service",
+			Namespace:   "http",
+			App:         name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fps = append(fps, fp)
+	}
+	publicFP, adminFP := fps[0], fps[1]
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	publicFP.SetClock(clock)
+	if err := publicFP.SetSeriesTTL(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { publicFP.Close() })
+
+	for _, fp := range fps {
+		app := fiber.New()
+		app.Use(fp.Middleware)
+		app.Get("/cached", func(c fiber.Ctx) error {
+			c.Set("X-Cache", "hit")
+			return c.SendString("Hello World")
+		})
+		resp, _ := app.Test(httptest.NewRequest("GET", "/cached", nil))
+		if resp.StatusCode != 200 {
+			t.Fail()
+		}
+	}
+
+	clock.Advance(2 * time.Hour)
+	publicFP.ExpireSeries(clock.Now())
+
+	// Only the public series expired, the admin ones share the vectors.
+	if got := testutil.CollectAndCount(adminFP.CacheResults()); got != 1 {
+		t.Errorf("got %d cache_results series; want the admin one", got)
+	}
+	if got := testutil.ToFloat64(adminFP.RequestsTotal().WithLabelValues("200", "GET", "/cached")); got != 1 {
+		t.Errorf("got %v admin requests; want 1", got)
+	}
+}
+
+func TestSharedCollectorsRequireApp(t *testing.T) {
+	t.Parallel()
+	registry := prometheus.NewRegistry()
+
+	if _, err := fiberprometheus.NewWithConfig(fiberprometheus.Config{Registerer: registry, Namespace: "http"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := fiberprometheus.NewWithConfig(fiberprometheus.Config{Registerer: registry, Namespace: "http"})
+	var already prometheus.AlreadyRegisteredError
+	if !errors.As(err, &already) {
+		t.Errorf("got %v; want an AlreadyRegisteredError without App", err)
+	}
+}
@@ -0,0 +1,272 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ShedAlgorithm selects how LoadShedder computes the concurrency limit of a
+// route.
+type ShedAlgorithm int
+
+const (
+	// ShedFixed rejects requests once a route has MaxInFlight requests in
+	// progress.
+	ShedFixed ShedAlgorithm = iota
+	// ShedAIMD grows the limit additively while requests are fast and
+	// successful, and cuts it multiplicatively when one exceeds
+	// TargetLatency or fails with a 5xx status.
+	ShedAIMD
+	// ShedGradient scales the limit by the ratio between the lowest and the
+	// current latency, leaving room for a small queue.
+	ShedGradient
+)
+
+// ShedderConfig configures LoadShedder.
+type ShedderConfig struct {
+	// Algorithm used to compute the limit. Defaults to ShedFixed.
+	Algorithm ShedAlgorithm
+
+	// MaxInFlight is the limit for ShedFixed. Zero disables shedding for
+	// routes not listed in RouteMaxInFlight.
+	MaxInFlight int
+
+	// RouteMaxInFlight overrides MaxInFlight per route template,
+	// e.g. "/users/:id".
+	RouteMaxInFlight map[string]int
+
+	// InitialLimit, MinLimit and MaxLimit bound the adaptive algorithms.
+	// They default to 20, 1 and 1000.
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+
+	// TargetLatency above which ShedAIMD backs off. Defaults to 1s.
+	TargetLatency time.Duration
+
+	// BackoffRatio the ShedAIMD limit is multiplied with on back off.
+	// Defaults to 0.9.
+	BackoffRatio float64
+
+	// RetryAfter is sent with rejected requests. Defaults to 1s.
+	RetryAfter time.Duration
+}
+
+// gradientProbeInterval is the number of samples after which the gradient
+// algorithm forgets its lowest latency, so it can follow a slower backend.
+const gradientProbeInterval = 1000
+
+// LoadShedder returns a middleware rejecting requests with 503 Service
+// Unavailable and a Retry-After header once a route reaches its concurrency
+// limit. Rejections are counted in shed_requests_total and the current limits
+// are exposed as concurrency_limit.
+//
+// It should be registered after Middleware, so rejected requests still show
+// up in requests_total:
+//
+//	app.Use(prom.Middleware)
+//	app.Use(shedder)
+func (ps *FiberPrometheus) LoadShedder(cfg ShedderConfig) (fiber.Handler, error) {
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = 20
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 1000
+	}
+	if cfg.TargetLatency <= 0 {
+		cfg.TargetLatency = time.Second
+	}
+	if cfg.BackoffRatio <= 0 || cfg.BackoffRatio >= 1 {
+		cfg.BackoffRatio = 0.9
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+
+	shed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "shed_requests_total"),
+		Help:        "Count all requests rejected by the load shedder by method and route.",
+		ConstLabels: ps.constLabels,
+	}, ps.labelNames("method", "route"))
+	limits := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "concurrency_limit"),
+		Help:        "Current concurrency limit of the load shedder by route.",
+		ConstLabels: ps.constLabels,
+	}, ps.labelNames("route"))
+	if err := ps.registerVecs(&shed, &limits); err != nil {
+		return nil, err
+	}
+
+	s := &shedder{
+		cfg:        cfg,
+		shed:       shed,
+		limits:     limits,
+		retryAfter: strconv.Itoa(int(math.Ceil(cfg.RetryAfter.Seconds()))),
+	}
+
+	return func(ctx fiber.Ctx) error {
+		route := ps.lookupRoute(ctx)
+		limiter := s.limiterFor(route)
+		if limiter == nil {
+			return ctx.Next()
+		}
+		if !limiter.acquire() {
+			s.shed.WithLabelValues(ctx.Method(), route).Inc()
+			ctx.Set(fiber.HeaderRetryAfter, s.retryAfter)
+			return fiber.ErrServiceUnavailable
+		}
+
+		start := ps.clock.Now()
+		failed := true
+		defer func() {
+			limiter.release(ps.clock.Since(start), failed)
+		}()
+
+		err := ctx.Next()
+		// Client errors say nothing about the load, only 5xx count.
+		failed = responseStatus(ctx, err) >= fiber.StatusInternalServerError
+		return err
+	}, nil
+}
+
+type shedder struct {
+	cfg        ShedderConfig
+	shed       *prometheus.CounterVec
+	limits     *prometheus.GaugeVec
+	retryAfter string
+	routes     sync.Map // route -> *routeLimiter
+}
+
+// limiterFor returns the limiter of a route, or nil if the route is not
+// limited.
+func (s *shedder) limiterFor(route string) *routeLimiter {
+	if v, ok := s.routes.Load(route); ok {
+		return v.(*routeLimiter)
+	}
+
+	limit := s.cfg.InitialLimit
+	if s.cfg.Algorithm == ShedFixed {
+		var ok bool
+		if limit, ok = s.cfg.RouteMaxInFlight[route]; !ok {
+			limit = s.cfg.MaxInFlight
+		}
+	}
+
+	// Unlimited routes are cached as nil.
+	var limiter *routeLimiter
+	if limit > 0 {
+		limiter = &routeLimiter{
+			algorithm: s.cfg.Algorithm,
+			min:       float64(s.cfg.MinLimit),
+			max:       float64(s.cfg.MaxLimit),
+			target:    s.cfg.TargetLatency,
+			backoff:   s.cfg.BackoffRatio,
+			gauge:     s.limits.WithLabelValues(route),
+			limit:     float64(limit),
+		}
+		limiter.gauge.Set(limiter.limit)
+	}
+
+	v, _ := s.routes.LoadOrStore(route, limiter)
+	return v.(*routeLimiter)
+}
+
+// routeLimiter holds the concurrency limit of a single route.
+type routeLimiter struct {
+	algorithm ShedAlgorithm
+	min, max  float64
+	target    time.Duration
+	backoff   float64
+	gauge     prometheus.Gauge
+
+	mu       sync.Mutex
+	inFlight int
+	limit    float64
+	minRTT   time.Duration
+	samples  int
+}
+
+func (l *routeLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inFlight) >= l.limit {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release marks a request as done and adapts the limit to its latency.
+func (l *routeLimiter) release(rtt time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+
+	limit := l.limit
+	switch l.algorithm {
+	case ShedAIMD:
+		if failed || rtt > l.target {
+			limit *= l.backoff
+		} else if float64(inFlight)*2 >= limit {
+			// Only grow while the limit is actually being used.
+			limit++
+		}
+	case ShedGradient:
+		if failed {
+			limit *= 0.9
+			break
+		}
+		l.samples++
+		if l.minRTT == 0 || rtt < l.minRTT || l.samples >= gradientProbeInterval {
+			l.minRTT = rtt
+			l.samples = 0
+		}
+		if rtt <= 0 {
+			break
+		}
+		gradient := math.Max(0.5, math.Min(1, float64(l.minRTT)/float64(rtt)))
+		queue := math.Sqrt(limit)
+		// Smooth the new limit to avoid reacting to a single outlier.
+		limit = 0.8*limit + 0.2*(limit*gradient+queue)
+	default:
+		return
+	}
+
+	limit = math.Max(l.min, math.Min(l.max, limit))
+	if limit != l.limit {
+		l.limit = limit
+		l.gauge.Set(limit)
+	}
+}
@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadShedderFixed(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	shedder, err := prometheus.LoadShedder(ShedderConfig{
+		RouteMaxInFlight: map[string]int{"/slow": 1},
+		RetryAfter:       1500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Use(shedder)
+
+	var nested int
+	var retryAfter string
+	app.Get("/slow", func(c fiber.Ctx) error {
+		// The only slot of /slow is taken by this very request.
+		resp, err := app.Test(httptest.NewRequest("GET", "/slow", nil))
+		if err != nil {
+			return err
+		}
+		nested = resp.StatusCode
+		retryAfter = resp.Header.Get(fiber.HeaderRetryAfter)
+		return c.SendString("done")
+	})
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	req := httptest.NewRequest("GET", "/slow", nil)
+	resp, _ := app.Test(req)
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+	if nested != fiber.StatusServiceUnavailable {
+		t.Errorf("got status %d for the nested request; want 503", nested)
+	}
+	if retryAfter != "2" {
+		t.Errorf("got Retry-After %q; want 2", retryAfter)
+	}
+
+	// Routes without a limit are never shed.
+	req = httptest.NewRequest("GET", "/", nil)
+	resp, _ = app.Test(req)
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ = app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	want := `http_shed_requests_total{method="GET",route="/slow",service="test-service"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_concurrency_limit{route="/slow",service="test-service"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_requests_total{method="GET",path="/slow",service="test-service",status_code="503"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	notWant := `http_concurrency_limit{route="/"`
+	if strings.Contains(got, notWant) {
+		t.Errorf("Expected / to be unlimited, but found: %s", notWant)
+	}
+}
+
+func TestLoadShedderClientErrors(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	shedder, err := prometheus.LoadShedder(ShedderConfig{
+		Algorithm:    ShedAIMD,
+		InitialLimit: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(shedder)
+	app.Get("/missing", func(c fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+	app.Get("/bad", func(c fiber.Ctx) error {
+		return fiber.ErrBadRequest
+	})
+	app.Get("/error", func(c fiber.Ctx) error {
+		return fiber.ErrInternalServerError
+	})
+
+	for range 10 {
+		for _, path := range []string{"/missing", "/bad"} {
+			app.Test(httptest.NewRequest("GET", path, nil))
+		}
+	}
+	app.Test(httptest.NewRequest("GET", "/error", nil))
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	// 4xx errors keep the limit, a 5xx backs off.
+	for _, want := range []string{
+		`http_concurrency_limit{route="/missing",service="test-service"} 4`,
+		`http_concurrency_limit{route="/bad",service="test-service"} 4`,
+		`http_concurrency_limit{route="/error",service="test-service"} 3.6`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func newTestLimiter(algorithm ShedAlgorithm, limit float64) *routeLimiter {
+	return &routeLimiter{
+		algorithm: algorithm,
+		min:       1,
+		max:       100,
+		target:    100 * time.Millisecond,
+		backoff:   0.5,
+		gauge:     prometheus.NewGauge(prometheus.GaugeOpts{Name: "limit"}),
+		limit:     limit,
+	}
+}
+
+func TestRouteLimiterAIMD(t *testing.T) {
+	t.Parallel()
+
+	limiter := newTestLimiter(ShedAIMD, 2)
+	for i := 0; i < 2; i++ {
+		if !limiter.acquire() {
+			t.Fatalf("request %d was shed below the limit", i)
+		}
+	}
+	if limiter.acquire() {
+		t.Fatal("request above the limit was not shed")
+	}
+
+	// A fast request while the limit is in use grows the limit.
+	limiter.release(time.Millisecond, false)
+	if limiter.limit != 3 {
+		t.Errorf("got limit %v after success; want 3", limiter.limit)
+	}
+
+	// A slow request backs off.
+	limiter.release(time.Second, false)
+	if limiter.limit != 1.5 {
+		t.Errorf("got limit %v after slow request; want 1.5", limiter.limit)
+	}
+
+	// The limit never drops below the minimum.
+	limiter.acquire()
+	limiter.release(time.Millisecond, true)
+	limiter.acquire()
+	limiter.release(time.Millisecond, true)
+	if limiter.limit != 1 {
+		t.Errorf("got limit %v after failures; want 1", limiter.limit)
+	}
+}
+
+func TestRouteLimiterGradient(t *testing.T) {
+	t.Parallel()
+
+	limiter := newTestLimiter(ShedGradient, 16)
+
+	// The first sample sets the baseline latency, leaving room to grow.
+	limiter.acquire()
+	limiter.release(10*time.Millisecond, false)
+	if limiter.limit <= 16 {
+		t.Errorf("got limit %v at baseline latency; want > 16", limiter.limit)
+	}
+
+	// Latency quadrupling shrinks the limit.
+	before := limiter.limit
+	for i := 0; i < 10; i++ {
+		limiter.acquire()
+		limiter.release(40*time.Millisecond, false)
+	}
+	if limiter.limit >= before {
+		t.Errorf("got limit %v after latency increase; want < %v", limiter.limit, before)
+	}
+}
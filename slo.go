@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the result label of requests_slo_total.
+const (
+	SLOSatisfied  = "satisfied"
+	SLOTolerating = "tolerating"
+	SLOFrustrated = "frustrated"
+)
+
+// sloRouteNameKey marks a latency target in a route name, see SLOConfig.
+const sloRouteNameKey = "slo="
+
+// SLOConfig configures the latency targets counted in requests_slo_total.
+//
+// Following Apdex, a request is satisfied when it completes within the
+// target T, tolerating within 4T and frustrated otherwise. Requests failing
+// with a 5xx status are always frustrated.
+//
+// The target of a route is looked up in Routes first, then in the route
+// name, then Threshold is used. A route name carries a target as a
+// `slo=<duration>` token separated by ';', e.g.
+//
+//	app.Get("/users", handler).Name("users.list;slo=300ms")
+//
+// Routes without a target are not counted.
+type SLOConfig struct {
+	// Threshold is the default target T.
+	Threshold time.Duration
+
+	// Routes overrides Threshold per route template, e.g. "/users/:id".
+	Routes map[string]time.Duration
+}
+
+// SetSLO enables the requests_slo_total counter, labelled by route and result,
+// from which Apdex and error budget burn rates can be computed:
+//
+//	(sum(rate(http_requests_slo_total{result="satisfied"}[5m]))
+//	  + sum(rate(http_requests_slo_total{result="tolerating"}[5m])) / 2)
+//	/ sum(rate(http_requests_slo_total[5m]))
+func (ps *FiberPrometheus) SetSLO(cfg SLOConfig) error {
+	if ps.slo != nil {
+		ps.slo = &sloTracker{cfg: cfg, counter: ps.slo.counter}
+		return nil
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "requests_slo_total"),
+		Help:        "Count all http requests by route and latency SLO result.",
+		ConstLabels: ps.constLabels,
+	}, ps.labelNames("route", "result"))
+	if err := ps.registerVecs(&counter); err != nil {
+		return err
+	}
+
+	ps.slo = &sloTracker{cfg: cfg, counter: counter}
+	return nil
+}
+
+type sloTracker struct {
+	cfg        SLOConfig
+	counter    *prometheus.CounterVec
+	thresholds sync.Map // sloKey -> time.Duration
+}
+
+// sloKey identifies a route by method, the route names holding the targets
+// differ per method.
+type sloKey struct {
+	method string
+	route  string
+}
+
+// observe counts a finished request. It must be called after ctx.Next().
+func (s *sloTracker) observe(ctx fiber.Ctx, status int, elapsed time.Duration) {
+	route := routeTemplate(ctx)
+	threshold := s.threshold(ctx.Route().Method, route, ctx.Route().Name)
+	if threshold <= 0 {
+		return
+	}
+
+	s.counter.WithLabelValues(route, sloResult(status, elapsed, threshold)).Inc()
+}
+
+// sloResult classifies a request against the target T the Apdex way.
+func sloResult(status int, elapsed, threshold time.Duration) string {
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		return SLOFrustrated
+	case elapsed <= threshold:
+		return SLOSatisfied
+	case elapsed <= 4*threshold:
+		return SLOTolerating
+	default:
+		return SLOFrustrated
+	}
+}
+
+func (s *sloTracker) threshold(method, route, name string) time.Duration {
+	key := sloKey{method: method, route: route}
+	if v, ok := s.thresholds.Load(key); ok {
+		return v.(time.Duration)
+	}
+
+	threshold, ok := s.cfg.Routes[route]
+	if !ok && route != unmatchedRoute {
+		threshold, ok = parseRouteSLO(name)
+	}
+	if !ok {
+		threshold = s.cfg.Threshold
+	}
+	s.thresholds.Store(key, threshold)
+	return threshold
+}
+
+// parseRouteSLO extracts the `slo=<duration>` token of a route name.
+func parseRouteSLO(name string) (time.Duration, bool) {
+	for _, token := range strings.Split(name, ";") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(token), sloRouteNameKey)
+		if !ok {
+			continue
+		}
+		threshold, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, false
+		}
+		return threshold, true
+	}
+	return 0, false
+}
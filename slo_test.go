@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestSLO(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	err := prometheus.SetSLO(SLOConfig{
+		Threshold: time.Hour,
+		Routes:    map[string]time.Duration{"/slow": time.Nanosecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	app.Get("/users/:id", func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	app.Get("/slow", func(c fiber.Ctx) error {
+		time.Sleep(time.Millisecond)
+		return c.SendString("Hello World")
+	})
+	app.Get("/named", func(c fiber.Ctx) error {
+		time.Sleep(time.Millisecond)
+		return c.SendString("Hello World")
+	}).Name("named;slo=1ns")
+	app.Get("/error", func(c fiber.Ctx) error {
+		return fiber.ErrBadGateway
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/slow", "/named", "/error"} {
+		req := httptest.NewRequest("GET", path, nil)
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	for _, want := range []string{
+		`http_requests_slo_total{result="satisfied",route="/users/:id",service="test-service"} 2`,
+		`http_requests_slo_total{result="frustrated",route="/slow",service="test-service"} 1`,
+		`http_requests_slo_total{result="frustrated",route="/named",service="test-service"} 1`,
+		`http_requests_slo_total{result="frustrated",route="/error",service="test-service"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestSLORouteNamePerMethod(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	if err := prometheus.SetSLO(SLOConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	app.Get("/users", func(c fiber.Ctx) error {
+		time.Sleep(time.Millisecond)
+		return c.SendString("Hello World")
+	}).Name("users.list;slo=1ns")
+	app.Post("/users", func(c fiber.Ctx) error {
+		time.Sleep(time.Millisecond)
+		return c.SendString("Hello World")
+	}).Name("users.create;slo=1h")
+
+	// The GET target must not be reused for POST on the same path.
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/users", nil)
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	for _, want := range []string{
+		`http_requests_slo_total{result="frustrated",route="/users",service="test-service"} 1`,
+		`http_requests_slo_total{result="satisfied",route="/users",service="test-service"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestSLOResult(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		status  int
+		elapsed time.Duration
+		want    string
+	}{
+		{200, 100 * time.Millisecond, SLOSatisfied},
+		{200, 101 * time.Millisecond, SLOTolerating},
+		{404, 400 * time.Millisecond, SLOTolerating},
+		{200, 401 * time.Millisecond, SLOFrustrated},
+		{503, time.Millisecond, SLOFrustrated},
+	}
+	for _, tc := range cases {
+		if got := sloResult(tc.status, tc.elapsed, 100*time.Millisecond); got != tc.want {
+			t.Errorf("sloResult(%d, %s) = %s; want %s", tc.status, tc.elapsed, got, tc.want)
+		}
+	}
+}
+
+func TestParseRouteSLO(t *testing.T) {
+	t.Parallel()
+
+	if got, ok := parseRouteSLO("users.list; slo=300ms"); !ok || got != 300*time.Millisecond {
+		t.Errorf("got %s, %v; want 300ms", got, ok)
+	}
+	for _, name := range []string{"", "users.list", "slo=fast"} {
+		if _, ok := parseRouteSLO(name); ok {
+			t.Errorf("expected %q to carry no target", name)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Defaults of the slow request rate limit.
+const (
+	defaultSlowRequestRate  = 1
+	defaultSlowRequestBurst = 5
+)
+
+// SlowRequest describes a request that exceeded its latency threshold.
+type SlowRequest struct {
+	Method string
+	// Route is the route template, e.g. "/users/:id".
+	Route string
+	// Path is the path label of the request series.
+	Path      string
+	Status    int
+	Duration  time.Duration
+	Threshold time.Duration
+	// RequestID is the request ID header of the response or the request.
+	RequestID string
+	// TraceID is the trace the request belongs to, the exemplar to look up
+	// in a tracing backend.
+	TraceID string
+	// Suppressed is the number of slow requests not reported since the
+	// previous report because of the rate limit.
+	Suppressed uint64
+}
+
+// SlowRequestConfig configures the reports of slow requests.
+//
+// The threshold of a route is looked up in Routes first, then Threshold is
+// used. Routes without a threshold are not reported.
+type SlowRequestConfig struct {
+	// Threshold is the default latency threshold.
+	Threshold time.Duration
+
+	// Routes overrides Threshold per route template, e.g. "/users/:id". A
+	// zero threshold disables the reports of a route.
+	Routes map[string]time.Duration
+
+	// Handler is called with each reported slow request, on the request's
+	// goroutine, once its metrics are recorded and without holding any lock
+	// of the middleware. Defaults to a warning logged with Logger.
+	Handler func(fiber.Ctx, SlowRequest)
+
+	// Logger of the default Handler. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Rate is the number of reports per second, with bursts of up to Burst
+	// reports. Defaults to 1 and 5.
+	Rate  float64
+	Burst int
+
+	// RequestIDHeader is the header holding the request ID. Defaults to
+	// X-Request-ID, as set by the requestid middleware.
+	RequestIDHeader string
+
+	// TraceID returns the trace ID of a request. Defaults to the trace ID of
+	// the W3C traceparent request header.
+	TraceID func(fiber.Ctx) string
+}
+
+// SetSlowRequestHook reports requests slower than their threshold, with the
+// duration measured by Middleware. Reports are rate limited, so a latency
+// spike does not flood the logs. Calling it again replaces the
+// configuration.
+func (ps *FiberPrometheus) SetSlowRequestHook(cfg SlowRequestConfig) error {
+	if cfg.Threshold < 0 {
+		return errors.New("fiberprometheus: slow request threshold must not be negative")
+	}
+	if cfg.Threshold == 0 && len(cfg.Routes) == 0 {
+		return errors.New("fiberprometheus: slow request hook needs a threshold")
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = defaultSlowRequestRate
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = defaultSlowRequestBurst
+	}
+	if cfg.RequestIDHeader == "" {
+		cfg.RequestIDHeader = fiber.HeaderXRequestID
+	}
+	if cfg.TraceID == nil {
+		cfg.TraceID = traceParentID
+	}
+	if cfg.Handler == nil {
+		logger := cfg.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		cfg.Handler = func(c fiber.Ctx, r SlowRequest) {
+			logSlowRequest(c.Context(), logger, r)
+		}
+	}
+
+	ps.slowRequests = &slowRequestTracker{
+		cfg:    cfg,
+		tokens: float64(cfg.Burst),
+	}
+	return nil
+}
+
+type slowRequestTracker struct {
+	cfg        SlowRequestConfig
+	thresholds sync.Map // route -> time.Duration
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed uint64
+}
+
+// observe reports a request finished at now if it is slow. It must be called
+// after ctx.Next().
+func (s *slowRequestTracker) observe(ctx fiber.Ctx, method, path string, status int, elapsed time.Duration, now time.Time) {
+	route := routeTemplate(ctx)
+	threshold := s.threshold(route)
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+	suppressed, ok := s.allow(now)
+	if !ok {
+		return
+	}
+
+	requestID := ctx.GetRespHeader(s.cfg.RequestIDHeader)
+	if requestID == "" {
+		requestID = ctx.Get(s.cfg.RequestIDHeader)
+	}
+	s.cfg.Handler(ctx, SlowRequest{
+		Method:     method,
+		Route:      route,
+		Path:       path,
+		Status:     status,
+		Duration:   elapsed,
+		Threshold:  threshold,
+		RequestID:  CopyString(requestID),
+		TraceID:    CopyString(s.cfg.TraceID(ctx)),
+		Suppressed: suppressed,
+	})
+}
+
+func (s *slowRequestTracker) threshold(route string) time.Duration {
+	if v, ok := s.thresholds.Load(route); ok {
+		return v.(time.Duration)
+	}
+
+	threshold, ok := s.cfg.Routes[route]
+	if !ok {
+		threshold = s.cfg.Threshold
+	}
+	s.thresholds.Store(route, threshold)
+	return threshold
+}
+
+// allow takes a token of the rate limit. It returns the number of reports
+// suppressed since the previous allowed one.
+func (s *slowRequestTracker) allow(now time.Time) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.last.IsZero() {
+		s.tokens += now.Sub(s.last).Seconds() * s.cfg.Rate
+		if burst := float64(s.cfg.Burst); s.tokens > burst {
+			s.tokens = burst
+		}
+	}
+	s.last = now
+	if s.tokens < 1 {
+		s.suppressed++
+		return 0, false
+	}
+	s.tokens--
+	suppressed := s.suppressed
+	s.suppressed = 0
+	return suppressed, true
+}
+
+// logSlowRequest is the default slow request handler.
+func logSlowRequest(ctx context.Context, logger *slog.Logger, r SlowRequest) {
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("route", r.Route),
+		slog.String("path", r.Path),
+		slog.Int("status", r.Status),
+		slog.Duration("duration", r.Duration),
+		slog.Duration("threshold", r.Threshold),
+	}
+	if r.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", r.RequestID))
+	}
+	if r.TraceID != "" {
+		attrs = append(attrs, slog.String("trace_id", r.TraceID))
+	}
+	if r.Suppressed > 0 {
+		attrs = append(attrs, slog.Uint64("suppressed", r.Suppressed))
+	}
+	logger.LogAttrs(ctx, slog.LevelWarn, "slow request", attrs...)
+}
+
+// traceParentID returns the trace ID of the W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func traceParentID(ctx fiber.Ctx) string {
+	parts := strings.Split(ctx.Get("traceparent"), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || strings.Trim(parts[1], "0") == "" {
+		return ""
+	}
+	for _, c := range parts[1] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return ""
+		}
+	}
+	return parts[1]
+}
@@ -0,0 +1,259 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/fiberprometheustest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSlowRequestHook(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	wait := func(c fiber.Ctx) error {
+		ms := fiber.Params[int](c, "ms")
+		clock.Advance(time.Duration(ms) * time.Millisecond)
+		c.Set(fiber.HeaderXRequestID, "request-"+c.Params("ms"))
+		return c.SendString("done")
+	}
+	app.Get("/wait/:ms", wait)
+	app.Get("/report/:ms", wait)
+	app.Get("/quiet/:ms", wait)
+
+	var reports []fiberprometheus.SlowRequest
+	err := fp.SetSlowRequestHook(fiberprometheus.SlowRequestConfig{
+		Threshold: 100 * time.Millisecond,
+		Routes: map[string]time.Duration{
+			"/report/:ms": time.Second,
+			"/quiet/:ms":  0,
+		},
+		Handler: func(_ fiber.Ctx, r fiberprometheus.SlowRequest) {
+			reports = append(reports, r)
+		},
+		Burst: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/wait/50", "/wait/100", "/wait/250", "/report/500", "/report/1500", "/quiet/5000"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		app.Test(req)
+	}
+
+	want := []fiberprometheus.SlowRequest{
+		{
+			Method: "GET", Route: "/wait/:ms", Path: "/wait/250", Status: 200,
+			Duration: 250 * time.Millisecond, Threshold: 100 * time.Millisecond,
+			RequestID: "request-250", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			Method: "GET", Route: "/report/:ms", Path: "/report/1500", Status: 200,
+			Duration: 1500 * time.Millisecond, Threshold: time.Second,
+			RequestID: "request-1500", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("got %+v; want %+v", reports, want)
+	}
+	for i := range want {
+		if reports[i] != want[i] {
+			t.Errorf("got %+v; want %+v", reports[i], want[i])
+		}
+	}
+}
+
+func TestSlowRequestHookOutsideSeriesLock(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	app.Get("/wait/:ms", func(c fiber.Ctx) error {
+		clock.Advance(time.Duration(fiber.Params[int](c, "ms")) * time.Millisecond)
+		c.Set(fiber.HeaderXRequestID, "request-"+c.Params("ms"))
+		return c.SendString("done")
+	})
+	if err := fp.SetSeriesTTL(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fp.SetSeriesTTL(0) })
+
+	// The hook may take a while, e.g. to log remotely. Expiring series
+	// meanwhile would wait for the request's lock if it was still held.
+	expired := make(chan struct{})
+	err := fp.SetSlowRequestHook(fiberprometheus.SlowRequestConfig{
+		Threshold: 100 * time.Millisecond,
+		Handler: func(fiber.Ctx, fiberprometheus.SlowRequest) {
+			go func() {
+				fp.ExpireSeries(time.Unix(1800000000, 0))
+				close(expired)
+			}()
+			select {
+			case <-expired:
+			case <-time.After(5 * time.Second):
+				t.Error("series expiry blocked by the slow request hook")
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.Test(httptest.NewRequest("GET", "/wait/250", nil))
+	<-expired
+}
+
+func TestSlowRequestRateLimit(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	app.Get("/wait/:ms", func(c fiber.Ctx) error {
+		clock.Advance(time.Duration(fiber.Params[int](c, "ms")) * time.Millisecond)
+		c.Set(fiber.HeaderXRequestID, "request-"+c.Params("ms"))
+		return c.SendString("done")
+	})
+
+	var reports []fiberprometheus.SlowRequest
+	err := fp.SetSlowRequestHook(fiberprometheus.SlowRequestConfig{
+		Threshold: 100 * time.Millisecond,
+		Handler: func(_ fiber.Ctx, r fiberprometheus.SlowRequest) {
+			reports = append(reports, r)
+		},
+		Rate:  1,
+		Burst: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each request takes 200ms and refills a fifth of a token.
+	for range 6 {
+		app.Test(httptest.NewRequest("GET", "/wait/200", nil))
+	}
+	if len(reports) != 3 {
+		t.Fatalf("got %d reports; want 3", len(reports))
+	}
+	if reports[0].Suppressed != 0 || reports[1].Suppressed != 0 || reports[2].Suppressed != 3 {
+		t.Errorf("got %+v; want the last report to count 3 suppressed requests", reports)
+	}
+}
+
+func TestSlowRequestLogger(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	app.Use(fp.Middleware)
+	app.Get("/wait/:ms", func(c fiber.Ctx) error {
+		clock.Advance(time.Duration(fiber.Params[int](c, "ms")) * time.Millisecond)
+		c.Set(fiber.HeaderXRequestID, "request-"+c.Params("ms"))
+		return c.SendString("done")
+	})
+
+	var buf bytes.Buffer
+	err := fp.SetSlowRequestHook(fiberprometheus.SlowRequestConfig{
+		Threshold: 100 * time.Millisecond,
+		Logger:    slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: dropTime})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Test(httptest.NewRequest("GET", "/wait/300", nil))
+
+	want := `level=WARN msg="slow request" method=GET route=/wait/:ms path=/wait/300 status=200 duration=300ms threshold=100ms request_id=request-300` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func dropTime(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return a
+}
+
+func TestSlowRequestInvalidConfig(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+
+	for _, cfg := range []fiberprometheus.SlowRequestConfig{
+		{},
+		{Threshold: -time.Second},
+	} {
+		if err := fp.SetSlowRequestHook(cfg); err == nil {
+			t.Errorf("got no error for %+v", cfg)
+		}
+	}
+	if err := fp.SetSlowRequestHook(fiberprometheus.SlowRequestConfig{Routes: map[string]time.Duration{"/": time.Second}}); err != nil {
+		t.Errorf("got %v for per-route thresholds only; want nil", err)
+	}
+}
+
+func TestTraceParentID(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString(fiberprometheus.TraceParentID(c))
+	})
+
+	for header, want := range map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01":   "",
+		"garbage": "",
+		"":        "",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("traceparent", header)
+		resp, _ := app.Test(req)
+		body, _ := io.ReadAll(resp.Body)
+		if got := string(body); got != want {
+			t.Errorf("%q: got %q; want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/timeout"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentTimeout returns a copy of cfg, for use with timeout.New, that
+// counts timed out requests in request_timeouts_total by route.
+//
+//	cfg, err := prom.InstrumentTimeout(timeout.Config{Timeout: 2 * time.Second})
+//	app.Get("/report", timeout.New(handler, cfg))
+func (ps *FiberPrometheus) InstrumentTimeout(cfg timeout.Config) (timeout.Config, error) {
+	if ps.timeoutsTotal == nil {
+		counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(ps.namespace, ps.subsystem, "request_timeouts_total"),
+			Help:        "Count all requests aborted by the timeout middleware by route.",
+			ConstLabels: ps.constLabels,
+		}, ps.labelNames("route"))
+		if err := ps.registerVecs(&counter); err != nil {
+			return cfg, err
+		}
+		ps.timeoutsTotal = counter
+	}
+
+	counter := ps.timeoutsTotal
+	onTimeout := cfg.OnTimeout
+	cfg.OnTimeout = func(c fiber.Ctx) error {
+		counter.WithLabelValues(ps.lookupRoute(c)).Inc()
+		if onTimeout == nil {
+			// Same as the timeout middleware without OnTimeout.
+			return fiber.ErrRequestTimeout
+		}
+		return onTimeout(c)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/timeout"
+)
+
+func TestInstrumentTimeout(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+
+	prometheus := New("test-service")
+	cfg, err := prometheus.InstrumentTimeout(timeout.Config{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second config shares the counter.
+	fast, err := prometheus.InstrumentTimeout(timeout.Config{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/reports/:id", timeout.New(func(c fiber.Ctx) error {
+		select {
+		case <-c.Context().Done():
+			// Both the deadline and this error are reported as timeouts.
+			return c.Context().Err()
+		case <-time.After(time.Second):
+			return c.SendString("too late")
+		}
+	}, cfg))
+	app.Get("/fast", timeout.New(func(c fiber.Ctx) error {
+		return c.SendString("Hello World")
+	}, fast))
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/reports/1", nil))
+	if resp.StatusCode != fiber.StatusRequestTimeout {
+		t.Errorf("got status %d; want 408", resp.StatusCode)
+	}
+	resp, _ = app.Test(httptest.NewRequest("GET", "/fast", nil))
+	if resp.StatusCode != 200 {
+		t.Fail()
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ = app.Test(req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	want := `http_request_timeouts_total{route="/reports/:id",service="test-service"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	notWant := `http_request_timeouts_total{route="/fast"`
+	if strings.Contains(got, notWant) {
+		t.Errorf("Expected /fast not to time out, but found: %s", notWant)
+	}
+}
@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// defaultUIRefresh is the refresh interval of the route statistics page.
+const defaultUIRefresh = 5 * time.Second
+
+// uiSnapshot is polled by the route statistics page to compute rates.
+type uiSnapshot struct {
+	Time   float64        `json:"time"`
+	Routes []RouteSummary `json:"routes"`
+}
+
+// RegisterUIAt registers an HTML page at the given URL showing a table of
+// the routes of this instance with their request rate, error rate, latency
+// percentiles and cache hit ratio, for local development. The page has no
+// external assets and refreshes every 5 seconds, or every ?refresh=<seconds>.
+// Rates are computed by the page between two refreshes.
+//
+// The page honours SetMetricsAuth and is not recorded by the middleware. The
+// refreshes are sent by the browser, which reuses basic auth credentials and
+// client certificates but can not add a bearer token: with
+// MetricsAuthConfig.BearerToken they fail with 401 unless a proxy in front
+// adds the header. Failed refreshes are reported below the table.
+func (ps *FiberPrometheus) RegisterUIAt(app *fiber.App, url string, handlers ...any) {
+	ps.endpointURLs = append(ps.endpointURLs, url)
+
+	h := append(handlers, ps.uiHandler)
+	app.Get(url, func(c fiber.Ctx) error {
+		return c.Next()
+	}, h...)
+}
+
+func (ps *FiberPrometheus) uiHandler(c fiber.Ctx) error {
+	if ok, err := ps.authorizeMetrics(c); !ok {
+		return err
+	}
+	routes := ps.RouteSummaries()
+	if c.Query("format") == "json" {
+		now := ps.clock.Now()
+		return c.JSON(uiSnapshot{
+			Time:   float64(now.UnixNano()) / 1e9,
+			Routes: routes,
+		})
+	}
+
+	refresh := defaultUIRefresh
+	if seconds, err := strconv.Atoi(c.Query("refresh")); err == nil && seconds > 0 {
+		refresh = time.Duration(seconds) * time.Second
+	}
+	c.Type("html", "utf-8")
+	return uiTemplate.Execute(c.Response().BodyWriter(), map[string]any{
+		"Title":   ps.uiTitle(),
+		"Refresh": refresh.Milliseconds(),
+		"Routes":  routes,
+	})
+}
+
+// uiTitle names the page after the const labels, e.g. service=orders.
+func (ps *FiberPrometheus) uiTitle() string {
+	var names []string
+	for _, name := range ps.constLabelNames() {
+		names = append(names, name+"="+ps.constLabels[name])
+	}
+	if ps.app != "" {
+		names = append(names, appLabel+"="+ps.app)
+	}
+	if len(names) == 0 {
+		return "Routes"
+	}
+	return "Routes of " + strings.Join(names, ", ")
+}
+
+// formatSeconds formats a latency in milliseconds, or a dash when unknown.
+func formatSeconds(v *float64) string {
+	if v == nil {
+		return "–"
+	}
+	return strconv.FormatFloat(*v*1000, 'f', 1, 64) + " ms"
+}
+
+// formatRatio formats a ratio as a percentage, or a dash when unknown.
+func formatRatio(v *float64) string {
+	if v == nil {
+		return "–"
+	}
+	return strconv.FormatFloat(*v*100, 'f', 1, 64) + "%"
+}
+
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"seconds": formatSeconds,
+	"ratio":   formatRatio,
+	"errorRate": func(r RouteSummary) string {
+		if r.Count == 0 {
+			return formatRatio(nil)
+		}
+		return formatRatio(&r.ErrorRate)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }}</title>
+<style>
+body { font: 14px/1.4 system-ui, sans-serif; margin: 2em; color: #222; background: #fafafa; }
+h1 { font-size: 1.3em; font-weight: 600; }
+table { border-collapse: collapse; width: 100%; background: #fff; }
+th, td { padding: .4em .8em; border-bottom: 1px solid #e4e4e4; text-align: right; white-space: nowrap; }
+th { background: #f0f0f0; font-weight: 600; }
+th:nth-child(-n+2), td:nth-child(-n+2) { text-align: left; }
+td:nth-child(2) { font-family: ui-monospace, monospace; white-space: normal; word-break: break-all; }
+.errors, .failed { color: #b3261e; }
+footer { margin-top: 1em; color: #777; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<table>
+<thead>
+<tr><th>Method</th><th>Route</th><th>Requests</th><th>Rate</th><th>Error rate</th><th>p50</th><th>p95</th><th>p99</th><th>Cache hit ratio</th></tr>
+</thead>
+<tbody id="routes">
+{{- range .Routes }}
+<tr><td>{{ .Method }}</td><td>{{ .Route }}</td><td>{{ .Count }}</td><td>–</td><td{{ if .Errors }} class="errors"{{ end }}>{{ errorRate . }}</td><td>{{ seconds .P50 }}</td><td>{{ seconds .P95 }}</td><td>{{ seconds .P99 }}</td><td>{{ ratio .CacheHitRatio }}</td></tr>
+{{- end }}
+</tbody>
+</table>
+<footer>Refreshes every {{ .Refresh }} ms. Rates are per second since the previous refresh. <span id="updated"></span></footer>
+<script>
+(function () {
+  var refresh = {{ .Refresh }};
+  var previous = null;
+  function seconds(v) { return v == null ? "–" : (v * 1000).toFixed(1) + " ms"; }
+  function ratio(v) { return v == null ? "–" : (v * 100).toFixed(1) + "%"; }
+  function cell(row, text, className) {
+    var td = document.createElement("td");
+    td.textContent = text;
+    if (className) { td.className = className; }
+    row.appendChild(td);
+  }
+  function render(snapshot) {
+    var counts = {};
+    var body = document.getElementById("routes");
+    body.textContent = "";
+    snapshot.routes.forEach(function (r) {
+      var key = r.method + " " + r.route;
+      counts[key] = r.count;
+      var rate = "–";
+      if (previous && previous.counts[key] !== undefined && snapshot.time > previous.time) {
+        rate = ((r.count - previous.counts[key]) / (snapshot.time - previous.time)).toFixed(2) + "/s";
+      }
+      var row = document.createElement("tr");
+      cell(row, r.method);
+      cell(row, r.route);
+      cell(row, r.count);
+      cell(row, rate);
+      cell(row, r.count ? ratio(r.error_rate) : "–", r.errors ? "errors" : "");
+      cell(row, seconds(r.p50_seconds));
+      cell(row, seconds(r.p95_seconds));
+      cell(row, seconds(r.p99_seconds));
+      cell(row, ratio(r.cache_hit_ratio));
+      body.appendChild(row);
+    });
+    previous = { time: snapshot.time, counts: counts };
+    var updated = document.getElementById("updated");
+    updated.className = "";
+    updated.textContent = "Updated " + new Date().toLocaleTimeString() + ".";
+  }
+  function failed(err) {
+    var updated = document.getElementById("updated");
+    updated.className = "failed";
+    updated.textContent = "Refresh failed: " + err.message + ".";
+  }
+  function poll() {
+    fetch(location.pathname + "?format=json", { credentials: "same-origin" })
+      .then(function (resp) {
+        if (!resp.ok) { throw new Error(resp.status + " " + resp.statusText); }
+        return resp.json();
+      })
+      .then(render)
+      .catch(failed)
+      .then(function () { setTimeout(poll, refresh); });
+  }
+  poll();
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,207 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/iamlookod/fiberprometheus/v3"
+	"github.com/iamlookod/fiberprometheus/v3/fiberprometheustest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterUIAt(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	fp.RegisterUIAt(app, "/metrics/ui")
+	app.Use(fp.Middleware)
+	app.Get("/fast", func(c fiber.Ctx) error {
+		clock.Advance(10 * time.Millisecond)
+		return c.SendString("fast")
+	})
+	app.Get("/slow", func(c fiber.Ctx) error {
+		clock.Advance(2 * time.Second)
+		return c.SendString("slow")
+	})
+	app.Get("/error", func(c fiber.Ctx) error {
+		clock.Advance(20 * time.Millisecond)
+		return fiber.ErrInternalServerError
+	})
+
+	for path, n := range map[string]int{"/fast": 100, "/slow": 10, "/error": 4} {
+		for range n {
+			app.Test(httptest.NewRequest("GET", path, nil))
+		}
+	}
+
+	results := []string{"miss", "hit", "hit", "hit"}
+	app.Get("/cached", func(c fiber.Ctx) error {
+		c.Set("X-Cache", results[0])
+		results = results[1:]
+		return c.SendString("cached")
+	})
+	for range results {
+		app.Test(httptest.NewRequest("GET", "/cached", nil))
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics/ui", nil))
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), fiber.MIMETextHTML) {
+		t.Fatalf("got status %d, %s; want an HTML page", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	for _, want := range []string{
+		"<title>Routes of service=test-service</title>",
+		"<tr><td>GET</td><td>/fast</td><td>100</td><td>–</td><td>0.0%</td><td>7.5 ms</td><td>9.8 ms</td><td>10.0 ms</td><td>–</td></tr>",
+		`<td class="errors">100.0%</td>`,
+		"<td>75.0%</td></tr>",
+		"var refresh =  5000 ;",
+		"<th>Method</th><th>Route</th>",
+		// Failed refreshes, e.g. a 401 with a bearer token, are shown.
+		"if (!resp.ok)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+	// The page loads no external assets.
+	for _, notWant := range []string{"src=", "href=", "http://", "https://"} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("got %q in the page", notWant)
+		}
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/metrics/ui?refresh=30", nil))
+	body, _ = io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "var refresh =  30000 ;") {
+		t.Errorf("got %s; want a 30s refresh", body)
+	}
+
+	// The page is not recorded as a request.
+	if got := testutil.ToFloat64(fp.RequestsTotal().WithLabelValues("200", "GET", "/metrics/ui")); got != 0 {
+		t.Errorf("got %v page requests recorded; want 0", got)
+	}
+}
+
+func TestRegisterUIAtJSON(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	clock := fiberprometheustest.NewFakeClock(time.Unix(1700000000, 0))
+	fp.SetClock(clock)
+
+	app := fiber.New()
+	fp.RegisterUIAt(app, "/metrics/ui")
+	app.Use(fp.Middleware)
+	app.Get("/fast", func(c fiber.Ctx) error {
+		clock.Advance(10 * time.Millisecond)
+		return c.SendString("fast")
+	})
+	app.Get("/slow", func(c fiber.Ctx) error {
+		clock.Advance(2 * time.Second)
+		return c.SendString("slow")
+	})
+	app.Get("/error", func(c fiber.Ctx) error {
+		clock.Advance(20 * time.Millisecond)
+		return fiber.ErrInternalServerError
+	})
+
+	for path, n := range map[string]int{"/fast": 100, "/slow": 10, "/error": 4} {
+		for range n {
+			app.Test(httptest.NewRequest("GET", path, nil))
+		}
+	}
+
+	results := []string{"miss", "hit", "hit", "hit"}
+	app.Get("/cached", func(c fiber.Ctx) error {
+		c.Set("X-Cache", results[0])
+		results = results[1:]
+		return c.SendString("cached")
+	})
+	for range results {
+		app.Test(httptest.NewRequest("GET", "/cached", nil))
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics/ui?format=json", nil))
+	var snapshot struct {
+		Time   float64                        `json:"time"`
+		Routes []fiberprometheus.RouteSummary `json:"routes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Time != 1700000021.08 || len(snapshot.Routes) != 4 {
+		t.Fatalf("got %+v; want the clock time and 4 routes", snapshot)
+	}
+	cached := snapshot.Routes[0]
+	if cached.Route != "/cached" || cached.Count != 4 || !approx(cached.CacheHitRatio, 0.75) {
+		t.Errorf("got %+v; want the cached route first", cached)
+	}
+}
+
+func TestUITemplateEscapes(t *testing.T) {
+	t.Parallel()
+	var buf strings.Builder
+	err := fiberprometheus.UITemplate.Execute(&buf, map[string]any{
+		"Title":   "Routes",
+		"Refresh": int64(5000),
+		"Routes":  []fiberprometheus.RouteSummary{{Method: "GET", Route: "/<script>alert(1)</script>", Count: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); strings.Contains(got, "<script>alert") || !strings.Contains(got, "&lt;script&gt;alert(1)") {
+		t.Errorf("got %s; want the route escaped", got)
+	}
+}
+
+func TestRegisterUIAtAuth(t *testing.T) {
+	t.Parallel()
+	fp := fiberprometheus.NewWithRegistry(prometheus.NewRegistry(), "test-service", "http", "", nil)
+	if err := fp.SetMetricsAuth(fiberprometheus.MetricsAuthConfig{Username: "admin", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	fp.RegisterUIAt(app, "/metrics/ui")
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics/ui", nil))
+	if resp.StatusCode != 401 {
+		t.Errorf("got status %d; want 401", resp.StatusCode)
+	}
+	req := httptest.NewRequest("GET", "/metrics/ui", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != 200 {
+		t.Errorf("got status %d; want 200", resp.StatusCode)
+	}
+}